@@ -7,6 +7,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -35,10 +37,23 @@ func main() {
 	defer mongoManager.Close()
 
 	sqliteFactory := db.NewSQLiteFactory()
+	if cacheMB := envInt("SANDBOX_CACHE_MB"); cacheMB > 0 {
+		sqliteFactory.Snapshots = db.NewSnapshotCache(cacheMB << 20)
+	}
+	if timeoutMS := envInt("SANDBOX_QUERY_TIMEOUT_MS"); timeoutMS > 0 {
+		sqliteFactory.Limits.QueryTimeout = time.Duration(timeoutMS) * time.Millisecond
+	}
+	if maxRows := envInt("SANDBOX_MAX_ROWS"); maxRows > 0 {
+		sqliteFactory.Limits.MaxRows = maxRows
+	}
+	if maxCell := envInt("SANDBOX_MAX_CELL_BYTES"); maxCell > 0 {
+		sqliteFactory.Limits.MaxCellBytes = maxCell
+	}
 
 	authHandler := handlers.NewAuthHandler(mongoManager)
 	caseHandler := handlers.NewCaseHandler(mongoManager)
 	gameHandler := handlers.NewGameHandler(mongoManager, sqliteFactory)
+	leaderboardHandler := handlers.NewLeaderboardHandler(mongoManager)
 
 	router := mux.NewRouter()
 
@@ -68,8 +83,13 @@ func main() {
 	router.Handle("/api/cases/initialize", auth.Middleware(http.HandlerFunc(caseHandler.InitializeCase))).Methods("POST")
 
 	router.Handle("/api/game/execute", auth.Middleware(http.HandlerFunc(gameHandler.ExecuteCommand))).Methods("POST")
+	router.Handle("/api/game/repair", auth.Middleware(http.HandlerFunc(gameHandler.RepairProgression))).Methods("POST")
 	router.Handle("/api/game/progress", auth.Middleware(http.HandlerFunc(gameHandler.GetProgress))).Methods("GET")
 
+	router.HandleFunc("/api/leaderboard", leaderboardHandler.GetGlobal).Methods("GET")
+	router.Handle("/api/leaderboard/opt-in", auth.Middleware(http.HandlerFunc(leaderboardHandler.OptIn))).Methods("POST")
+	router.HandleFunc("/api/leaderboard/{id}", leaderboardHandler.GetCase).Methods("GET")
+
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
@@ -87,3 +107,11 @@ func main() {
 	log.Printf("🚀 Servidor iniciado na porta %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, corsHandler.Handler(router)))
 }
+
+func envInt(key string) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,136 @@
+package conditions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// State é o que uma condição pode consultar da progressão do jogador.
+type State interface {
+	Puzzle() int
+	Focus() string
+	InFocus(object string) bool
+	Flag(name string) bool
+	Visited(name string) bool
+	Counter(name string) int
+	HasItem(name string) bool
+	Solved(puzzle int) bool
+}
+
+// Expr é uma condição já analisada e verificada; avaliar não volta a
+// interpretar o texto.
+type Expr struct {
+	source string
+	eval   func(State) bool
+}
+
+func (e *Expr) Eval(s State) bool {
+	if e == nil {
+		return false
+	}
+	return e.eval(s)
+}
+
+func (e *Expr) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.source
+}
+
+// Never é usada no lugar de condições vazias ou inválidas.
+var Never = &Expr{source: "false", eval: func(State) bool { return false }}
+
+// Always é usada quando a ausência de condição significa "sempre vale".
+var Always = &Expr{source: "true", eval: func(State) bool { return true }}
+
+// Compile analisa e verifica os tipos de uma expressão, por exemplo:
+//
+//	puzzle = 3 AND focus = 'quadro'
+//	puzzle BETWEEN 2 AND 5
+//	flag.porta_aberta AND item.chave AND NOT visited.cofre
+//	counter.tentativas >= 3 OR focus IN ('mesa', 'gaveta')
+//	focus.mesa AND NOT focus.gaveta
+//
+// focus compara só o foco atual; focus.<objeto> vale também quando o objeto
+// contém o foco atual. AND/OR/NOT também aceitam E/OU/NAO e BETWEEN aceita
+// ENTRE.
+func Compile(source string) (*Expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	result, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("trecho inesperado %q", p.peek().text)
+	}
+	if result.typ != typeBool {
+		return nil, fmt.Errorf("a condição precisa ser verdadeira ou falsa, mas é %s", result.typ)
+	}
+
+	return &Expr{source: source, eval: result.boolFn}, nil
+}
+
+var legacyConditions = map[string]bool{
+	"always":               true,
+	"puzzle_state":         true,
+	"puzzle_state_not":     true,
+	"puzzle_state_less":    true,
+	"puzzle_state_greater": true,
+	"current_focus_none":   true,
+}
+
+// IsLegacy diz se condition é um dos nomes antigos de CommandResponse, que
+// usam o campo Value como argumento.
+func IsLegacy(condition string) bool {
+	return legacyConditions[condition]
+}
+
+// IsLegacyName diz se condition tem a forma de um nome antigo (uma palavra
+// em snake_case), conhecido ou não.
+func IsLegacyName(condition string) bool {
+	if condition == "" {
+		return false
+	}
+	for i := 0; i < len(condition); i++ {
+		c := condition[i]
+		if (c < 'a' || c > 'z') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Legacy converte uma condição antiga (condition + value) na expressão
+// equivalente.
+func Legacy(condition, value string) (*Expr, error) {
+	switch condition {
+	case "always":
+		return Compile("true")
+	case "current_focus_none":
+		return Compile("focus = 'none'")
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("condição %s exige um número em value, recebeu %q", condition, value)
+	}
+
+	switch condition {
+	case "puzzle_state":
+		return Compile(fmt.Sprintf("puzzle = %d", n))
+	case "puzzle_state_not":
+		return Compile(fmt.Sprintf("puzzle != %d", n))
+	case "puzzle_state_less":
+		return Compile(fmt.Sprintf("puzzle < %d", n))
+	case "puzzle_state_greater":
+		return Compile(fmt.Sprintf("puzzle > %d", n))
+	}
+	return nil, fmt.Errorf("condição desconhecida %q", condition)
+}
@@ -0,0 +1,239 @@
+package conditions
+
+import (
+	"strings"
+	"testing"
+)
+
+type fakeState struct {
+	puzzle   int
+	focus    []string
+	flags    map[string]bool
+	visited  map[string]bool
+	counters map[string]int
+	items    map[string]bool
+	solved   map[int]bool
+}
+
+func (s fakeState) Puzzle() int { return s.puzzle }
+
+func (s fakeState) Focus() string {
+	if len(s.focus) == 0 {
+		return "none"
+	}
+	return s.focus[len(s.focus)-1]
+}
+
+func (s fakeState) InFocus(object string) bool {
+	for _, f := range s.focus {
+		if strings.EqualFold(f, object) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s fakeState) Flag(name string) bool    { return s.flags[name] }
+func (s fakeState) Visited(name string) bool { return s.visited[name] }
+func (s fakeState) Counter(name string) int  { return s.counters[name] }
+func (s fakeState) HasItem(name string) bool { return s.items[name] }
+func (s fakeState) Solved(puzzle int) bool   { return s.solved[puzzle] }
+
+var state = fakeState{
+	puzzle:   3,
+	focus:    []string{"mesa", "gaveta"},
+	flags:    map[string]bool{"porta_aberta": true},
+	visited:  map[string]bool{"quadro": true},
+	counters: map[string]int{"tentativas": 2},
+	items:    map[string]bool{"chave": true},
+	solved:   map[int]bool{1: true, 2: true},
+}
+
+func TestCompileEval(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"always", true},
+		{"puzzle = 3", true},
+		{"puzzle == 4", false},
+		{"puzzle != 3", false},
+		{"puzzle <> 4", true},
+		{"puzzle < 4 AND puzzle <= 3 AND puzzle > 2 AND puzzle >= 3", true},
+		{"puzzle > -1", true},
+		{"focus = 'gaveta'", true},
+		{"focus = 'mesa'", false},
+		{"foco = \"GAVETA\"", true},
+		{"focus.mesa", true},
+		{"foco.gaveta AND NOT focus.quadro", true},
+		{"focus IN ('mesa', 'gaveta')", true},
+		{"puzzle IN (1, 2)", false},
+		{"puzzle EM (3)", true},
+		{"flag.porta_aberta", true},
+		{"flags.cofre", false},
+		{"visited.quadro AND visitado.quadro", true},
+		{"counter.tentativas >= 2", true},
+		{"contador.erros = 0", true},
+		{"item.chave AND inventory.chave AND inventario.chave", true},
+		{"item.lanterna", false},
+		{"solved.1 AND resolvido.2 AND NOT solved.3", true},
+
+		// precedência: NOT > AND > OR
+		{"true OR false AND false", true},
+		{"(true OR false) AND false", false},
+		{"NOT false AND false", false},
+		{"NOT (false AND false)", true},
+		{"false OR NOT false", true},
+
+		// o AND do BETWEEN não é o AND lógico
+		{"puzzle BETWEEN 2 AND 5", true},
+		{"puzzle BETWEEN 4 AND 5", false},
+		{"puzzle BETWEEN 2 AND 5 AND flag.porta_aberta", true},
+		{"puzzle BETWEEN 2 AND 5 AND item.lanterna", false},
+		{"puzzle ENTRE 1 E 3 E item.chave", true},
+		{"item.lanterna OR puzzle BETWEEN 3 AND 3", true},
+
+		// apelidos em português e símbolos
+		{"flag.porta_aberta E item.chave", true},
+		{"item.lanterna OU item.chave", true},
+		{"NAO item.lanterna", true},
+		{"NÃO item.chave", false},
+		{"!item.lanterna && (flag.porta_aberta || false)", true},
+		{"not item.lanterna and puzzle = 3", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			expr, err := Compile(tt.source)
+			if err != nil {
+				t.Fatalf("Compile(%q): %v", tt.source, err)
+			}
+			if got := expr.Eval(state); got != tt.want {
+				t.Errorf("Eval(%q) = %v, quer %v", tt.source, got, tt.want)
+			}
+			if expr.String() != tt.source {
+				t.Errorf("String() = %q, quer %q", expr.String(), tt.source)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		// tipos
+		{"puzzle", "precisa ser verdadeira ou falsa, mas é número"},
+		{"focus", "precisa ser verdadeira ou falsa, mas é texto"},
+		{"puzzle = 'tres'", "posição 14: = compara número com texto"},
+		{"focus < 'mesa'", "posição 13: < só compara números, mas recebeu texto"},
+		{"puzzle AND true", "posição 16: AND espera booleano, mas recebeu número"},
+		{"true OR counter.x", "posição 18: OR espera booleano, mas recebeu número"},
+		{"NOT puzzle", "posição 11: NOT espera booleano, mas recebeu número"},
+		{"focus BETWEEN 1 AND 2", "BETWEEN só compara números, mas recebeu texto"},
+		{"puzzle IN (1, 'dois')", "posição 21: IN compara número com texto"},
+
+		// sintaxe e posições
+		{"", "posição 0: condição incompleta"},
+		{"puzzle =", "posição 9: condição incompleta"},
+		{"puzzle = 3 AND", "posição 15: condição incompleta"},
+		{"(puzzle = 3", "posição 12: esperava \")\""},
+		{"puzzle = 3)", "posição 11: trecho inesperado \")\""},
+		{"puzzle = 3 flag.x", "posição 12: trecho inesperado \"flag.x\""},
+		{"puzzle BETWEEN 1 OR 2", "posição 18: BETWEEN espera AND entre os limites"},
+		{"puzzle IN 1", "posição 11: IN espera uma lista entre parênteses"},
+		{"puzzle IN (1 2)", "esperava \",\" ou \")\" na lista do IN"},
+		{"focus = 'mesa", "posição 9: texto sem aspas de fechamento"},
+		{"puzzle & 1", "posição 8: caractere inesperado \"&\""},
+		{"puzzle = 3 ; true", "posição 12: caractere inesperado \";\""},
+
+		// nomes
+		{"fase = 1", "posição 1: nome desconhecido \"fase\""},
+		{"cofre.aberto", "posição 1: prefixo desconhecido \"cofre\""},
+		{"flag.", "posição 1: nome desconhecido \"flag.\""},
+		{"flag.a.b", "posição 1: nome desconhecido \"flag.a.b\""},
+		{"solved.um", "posição 1: solved.um espera o número do puzzle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			expr, err := Compile(tt.source)
+			if err == nil {
+				t.Fatalf("Compile(%q) compilou %v, esperava erro", tt.source, expr)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Compile(%q) = %q, quer conter %q", tt.source, err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	tests := []struct {
+		condition string
+		value     string
+		want      bool
+	}{
+		{"always", "", true},
+		{"current_focus_none", "", false},
+		{"puzzle_state", "3", true},
+		{"puzzle_state", " 2 ", false},
+		{"puzzle_state_not", "2", true},
+		{"puzzle_state_less", "4", true},
+		{"puzzle_state_greater", "3", false},
+	}
+
+	for _, tt := range tests {
+		if !IsLegacy(tt.condition) {
+			t.Errorf("IsLegacy(%q) = false", tt.condition)
+		}
+		expr, err := Legacy(tt.condition, tt.value)
+		if err != nil {
+			t.Fatalf("Legacy(%q, %q): %v", tt.condition, tt.value, err)
+		}
+		if got := expr.Eval(state); got != tt.want {
+			t.Errorf("Legacy(%q, %q) = %v, quer %v", tt.condition, tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := Legacy("puzzle_state", "três"); err == nil {
+		t.Error("Legacy com value não numérico deveria falhar")
+	}
+	if IsLegacy("puzzle = 3") {
+		t.Error("IsLegacy não deveria aceitar expressões")
+	}
+}
+
+func TestIsLegacyName(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{"puzzle_state", true},
+		{"puzzle_estado", true},
+		{"true", true},
+		{"", false},
+		{"puzzle = 3", false},
+		{"flag.porta", false},
+		{"Puzzle_State", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsLegacyName(tt.condition); got != tt.want {
+			t.Errorf("IsLegacyName(%q) = %v, quer %v", tt.condition, got, tt.want)
+		}
+	}
+}
+
+func TestNilExpr(t *testing.T) {
+	var expr *Expr
+	if expr.Eval(state) {
+		t.Error("Expr nil deveria ser falsa")
+	}
+	if Never.Eval(state) || !Always.Eval(state) {
+		t.Error("Never e Always invertidos")
+	}
+}
@@ -0,0 +1,420 @@
+package conditions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type valueType int
+
+const (
+	typeBool valueType = iota
+	typeInt
+	typeString
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typeBool:
+		return "booleano"
+	case typeInt:
+		return "número"
+	default:
+		return "texto"
+	}
+}
+
+// operand é um trecho já compilado; só a função do seu tipo é preenchida.
+type operand struct {
+	typ      valueType
+	boolFn   func(State) bool
+	intFn    func(State) int
+	stringFn func(State) string
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokString
+	tokSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(source string) ([]token, error) {
+	tokens := make([]token, 0)
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("posição %d: texto sem aspas de fechamento", i+1)
+			}
+			tokens = append(tokens, token{kind: tokString, text: source[i+1 : i+1+end], pos: i + 1})
+			i += end + 2
+
+		case c >= '0' && c <= '9' || (c == '-' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9'):
+			start := i
+			i++
+			for i < len(source) && source[i] >= '0' && source[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: source[start:i], pos: start + 1})
+
+		case isIdentPart(c):
+			start := i
+			for i < len(source) && (isIdentPart(source[i]) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: source[start:i], pos: start + 1})
+
+		default:
+			start := i
+			size := 1
+			if i+1 < len(source) {
+				switch source[i : i+2] {
+				case "==", "!=", "<>", "<=", ">=", "&&", "||":
+					size = 2
+				}
+			}
+			text := source[i : i+size]
+			if !symbols[text] {
+				return nil, fmt.Errorf("posição %d: caractere inesperado %q", start+1, text)
+			}
+			tokens = append(tokens, token{kind: tokSymbol, text: text, pos: start + 1})
+			i += size
+		}
+	}
+	return tokens, nil
+}
+
+var symbols = map[string]bool{
+	"=": true, "==": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+	"&&": true, "||": true, "!": true, "(": true, ")": true, ",": true,
+}
+
+func isIdentPart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	pos := 0
+	if !p.done() {
+		pos = p.peek().pos
+	} else if len(p.tokens) > 0 {
+		last := p.tokens[len(p.tokens)-1]
+		pos = last.pos + len(last.text)
+	}
+	return fmt.Errorf("posição %d: %s", pos, fmt.Sprintf(format, args...))
+}
+
+// accept consome o próximo token se ele for uma das palavras (sem diferenciar
+// maiúsculas) ou símbolos informados.
+func (p *parser) accept(options ...string) bool {
+	if p.done() {
+		return false
+	}
+	tok := p.peek()
+	if tok.kind != tokIdent && tok.kind != tokSymbol {
+		return false
+	}
+	for _, o := range options {
+		if strings.EqualFold(tok.text, o) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expectBool(o operand, context string) error {
+	if o.typ != typeBool {
+		return p.errorf("%s espera booleano, mas recebeu %s", context, o.typ)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (operand, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return operand{}, err
+	}
+	for p.accept("OR", "OU", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return operand{}, err
+		}
+		if err := p.expectBool(left, "OR"); err != nil {
+			return operand{}, err
+		}
+		if err := p.expectBool(right, "OR"); err != nil {
+			return operand{}, err
+		}
+		l, r := left.boolFn, right.boolFn
+		left = operand{typ: typeBool, boolFn: func(s State) bool { return l(s) || r(s) }}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (operand, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return operand{}, err
+	}
+	for p.accept("AND", "E", "&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return operand{}, err
+		}
+		if err := p.expectBool(left, "AND"); err != nil {
+			return operand{}, err
+		}
+		if err := p.expectBool(right, "AND"); err != nil {
+			return operand{}, err
+		}
+		l, r := left.boolFn, right.boolFn
+		left = operand{typ: typeBool, boolFn: func(s State) bool { return l(s) && r(s) }}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (operand, error) {
+	if p.accept("NOT", "NAO", "NÃO", "!") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return operand{}, err
+		}
+		if err := p.expectBool(inner, "NOT"); err != nil {
+			return operand{}, err
+		}
+		fn := inner.boolFn
+		return operand{typ: typeBool, boolFn: func(s State) bool { return !fn(s) }}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (operand, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return operand{}, err
+	}
+
+	switch {
+	case p.accept("BETWEEN", "ENTRE"):
+		low, err := p.parsePrimary()
+		if err != nil {
+			return operand{}, err
+		}
+		if !p.accept("AND", "E") {
+			return operand{}, p.errorf("BETWEEN espera AND entre os limites")
+		}
+		high, err := p.parsePrimary()
+		if err != nil {
+			return operand{}, err
+		}
+		for _, o := range []operand{left, low, high} {
+			if o.typ != typeInt {
+				return operand{}, p.errorf("BETWEEN só compara números, mas recebeu %s", o.typ)
+			}
+		}
+		v, lo, hi := left.intFn, low.intFn, high.intFn
+		return operand{typ: typeBool, boolFn: func(s State) bool {
+			n := v(s)
+			return n >= lo(s) && n <= hi(s)
+		}}, nil
+
+	case p.accept("IN", "EM"):
+		if !p.accept("(") {
+			return operand{}, p.errorf("IN espera uma lista entre parênteses")
+		}
+		items := make([]operand, 0)
+		for {
+			item, err := p.parsePrimary()
+			if err != nil {
+				return operand{}, err
+			}
+			if item.typ != left.typ {
+				return operand{}, p.errorf("IN compara %s com %s", left.typ, item.typ)
+			}
+			items = append(items, item)
+			if p.accept(")") {
+				break
+			}
+			if !p.accept(",") {
+				return operand{}, p.errorf("esperava \",\" ou \")\" na lista do IN")
+			}
+		}
+		return operand{typ: typeBool, boolFn: func(s State) bool {
+			for _, item := range items {
+				if equalOperands(left, item, s) {
+					return true
+				}
+			}
+			return false
+		}}, nil
+	}
+
+	if p.done() || p.peek().kind != tokSymbol {
+		return left, nil
+	}
+
+	op := p.peek().text
+	switch op {
+	case "=", "==", "!=", "<>", "<", "<=", ">", ">=":
+		p.pos++
+	default:
+		return left, nil
+	}
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return operand{}, err
+	}
+	if left.typ != right.typ {
+		return operand{}, p.errorf("%s compara %s com %s", op, left.typ, right.typ)
+	}
+
+	switch op {
+	case "=", "==":
+		return operand{typ: typeBool, boolFn: func(s State) bool { return equalOperands(left, right, s) }}, nil
+	case "!=", "<>":
+		return operand{typ: typeBool, boolFn: func(s State) bool { return !equalOperands(left, right, s) }}, nil
+	}
+
+	if left.typ != typeInt {
+		return operand{}, p.errorf("%s só compara números, mas recebeu %s", op, left.typ)
+	}
+	l, r := left.intFn, right.intFn
+	var cmp func(a, b int) bool
+	switch op {
+	case "<":
+		cmp = func(a, b int) bool { return a < b }
+	case "<=":
+		cmp = func(a, b int) bool { return a <= b }
+	case ">":
+		cmp = func(a, b int) bool { return a > b }
+	default:
+		cmp = func(a, b int) bool { return a >= b }
+	}
+	return operand{typ: typeBool, boolFn: func(s State) bool { return cmp(l(s), r(s)) }}, nil
+}
+
+func equalOperands(a, b operand, s State) bool {
+	switch a.typ {
+	case typeInt:
+		return a.intFn(s) == b.intFn(s)
+	case typeString:
+		return strings.EqualFold(a.stringFn(s), b.stringFn(s))
+	default:
+		return a.boolFn(s) == b.boolFn(s)
+	}
+}
+
+func (p *parser) parsePrimary() (operand, error) {
+	if p.done() {
+		return operand{}, p.errorf("condição incompleta")
+	}
+
+	tok := p.peek()
+	switch tok.kind {
+	case tokNumber:
+		p.pos++
+		n, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return operand{}, p.errorf("número inválido %q", tok.text)
+		}
+		return operand{typ: typeInt, intFn: func(State) int { return n }}, nil
+
+	case tokString:
+		p.pos++
+		text := tok.text
+		return operand{typ: typeString, stringFn: func(State) string { return text }}, nil
+
+	case tokSymbol:
+		if !p.accept("(") {
+			return operand{}, p.errorf("trecho inesperado %q", tok.text)
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return operand{}, err
+		}
+		if !p.accept(")") {
+			return operand{}, p.errorf("esperava \")\"")
+		}
+		return inner, nil
+	}
+
+	p.pos++
+	return p.variable(tok)
+}
+
+// variable resolve os nomes disponíveis nas condições: puzzle, focus e os
+// prefixos focus., flag., visited., counter., item. e solved. (ou foco,
+// foco., visitado., contador., inventario. e resolvido.).
+func (p *parser) variable(tok token) (operand, error) {
+	name := strings.ToLower(tok.text)
+
+	switch name {
+	case "true", "always":
+		return operand{typ: typeBool, boolFn: func(State) bool { return true }}, nil
+	case "false":
+		return operand{typ: typeBool, boolFn: func(State) bool { return false }}, nil
+	case "puzzle":
+		return operand{typ: typeInt, intFn: func(s State) int { return s.Puzzle() }}, nil
+	case "focus", "foco":
+		return operand{typ: typeString, stringFn: func(s State) string { return s.Focus() }}, nil
+	}
+
+	prefix, key, ok := strings.Cut(name, ".")
+	if !ok || key == "" || strings.Contains(key, ".") {
+		return operand{}, fmt.Errorf("posição %d: nome desconhecido %q", tok.pos, tok.text)
+	}
+
+	switch prefix {
+	case "focus", "foco":
+		return operand{typ: typeBool, boolFn: func(s State) bool { return s.InFocus(key) }}, nil
+	case "flag", "flags":
+		return operand{typ: typeBool, boolFn: func(s State) bool { return s.Flag(key) }}, nil
+	case "visited", "visitado":
+		return operand{typ: typeBool, boolFn: func(s State) bool { return s.Visited(key) }}, nil
+	case "counter", "contador":
+		return operand{typ: typeInt, intFn: func(s State) int { return s.Counter(key) }}, nil
+	case "item", "inventory", "inventario":
+		return operand{typ: typeBool, boolFn: func(s State) bool { return s.HasItem(key) }}, nil
+	case "solved", "resolvido":
+		n, err := strconv.Atoi(key)
+		if err != nil {
+			return operand{}, fmt.Errorf("posição %d: %s espera o número do puzzle", tok.pos, tok.text)
+		}
+		return operand{typ: typeBool, boolFn: func(s State) bool { return s.Solved(n) }}, nil
+	}
+	return operand{}, fmt.Errorf("posição %d: prefixo desconhecido %q (use focus., flag., visited., counter., item. ou solved.)", tok.pos, prefix)
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// CaseCompileError lista as condições do caso que não compilaram. O caso
+// não é servido enquanto o autor não corrigir a expressão.
+type CaseCompileError struct {
+	CaseID  string
+	Version int
+	Errors  []error
+}
+
+func (e *CaseCompileError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("caso %s (versão %d) tem condições inválidas: %s", e.CaseID, e.Version, strings.Join(messages, "; "))
+}
+
+// Details devolve uma mensagem por condição inválida.
+func (e *CaseCompileError) Details() []string {
+	details := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		details = append(details, err.Error())
+	}
+	return details
+}
+
+type compiledCase struct {
+	version int
+	caso    *models.Case
+	err     *CaseCompileError
+}
+
+// load devolve uma cópia rasa do caso: as condições compiladas são só de
+// leitura e podem ser compartilhadas entre requisições.
+func (c *compiledCase) load() (*models.Case, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	caso := *c.caso
+	return &caso, nil
+}
+
+// caseCache guarda a última versão compilada de cada caso; uma versão nova
+// substitui a anterior.
+type caseCache struct {
+	mu    sync.RWMutex
+	cases map[string]*compiledCase
+}
+
+var compiledCases = &caseCache{cases: map[string]*compiledCase{}}
+
+func (c *caseCache) get(caseID string, version int) (*compiledCase, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.cases[caseID]
+	if !ok || entry.version != version {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *caseCache) put(caseID string, version int, entry *compiledCase) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.version = version
+	c.cases[caseID] = entry
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RecordFailedAttempt soma uma tentativa com erro ao puzzle. Comandos com
+// erro não regravam a progressão, por isso o contador é atualizado direto.
+func (m *MongoManager) RecordFailedAttempt(userID primitive.ObjectID, caseID string, puzzle int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.ProgressionColl.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID, "case_id": caseID},
+		bson.M{"$inc": bson.M{fmt.Sprintf("puzzle_stats.%d.failed_attempts", puzzle): 1}},
+	)
+	return err
+}
+
+// SaveScore grava a pontuação do jogador no caso, a menos que ele já tenha
+// uma maior.
+func (m *MongoManager) SaveScore(score *models.Score) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": score.UserID, "case_id": score.CaseID}
+
+	var existing models.Score
+	err := m.ScoresColl.FindOne(ctx, filter).Decode(&existing)
+	if err == nil && existing.Total >= score.Total {
+		return nil
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	_, err = m.ScoresColl.ReplaceOne(ctx, filter, score, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoManager) GetLeaderboardPrefs(userID primitive.ObjectID) (*models.LeaderboardPrefs, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var prefs models.LeaderboardPrefs
+	err := m.LeaderboardColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&prefs)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// SaveLeaderboardPrefs grava a preferência e a aplica às pontuações que o
+// jogador já tem.
+func (m *MongoManager) SaveLeaderboardPrefs(prefs *models.LeaderboardPrefs) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	prefs.UpdatedAt = time.Now()
+	_, err := m.LeaderboardColl.ReplaceOne(ctx, bson.M{"_id": prefs.UserID}, prefs, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{"public": prefs.OptIn}
+	if prefs.DisplayName != "" {
+		set["display_name"] = prefs.DisplayName
+	}
+	_, err = m.ScoresColl.UpdateMany(ctx, bson.M{"user_id": prefs.UserID}, bson.M{"$set": set})
+	return err
+}
+
+// CaseLeaderboard lista as pontuações públicas do caso, da maior para a
+// menor; no empate, quem terminou primeiro fica à frente.
+func (m *MongoManager) CaseLeaderboard(caseID string, page, pageSize int) ([]models.LeaderboardEntry, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"case_id": caseID, "public": true}
+	total, err := m.ScoresColl.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "total", Value: -1}, {Key: "completed_at", Value: 1}}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+
+	cursor, err := m.ScoresColl.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]models.LeaderboardEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, err
+	}
+	rankEntries(entries, page, pageSize)
+	return entries, total, nil
+}
+
+// GlobalLeaderboard soma as pontuações públicas de cada jogador em todos os
+// casos.
+func (m *MongoManager) GlobalLeaderboard(page, pageSize int) ([]models.LeaderboardEntry, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"public": true}}},
+		{{Key: "$sort", Value: bson.M{"completed_at": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":             "$user_id",
+			"display_name":    bson.M{"$last": "$display_name"},
+			"guest":           bson.M{"$last": "$guest"},
+			"total":           bson.M{"$sum": "$total"},
+			"cases_completed": bson.M{"$sum": 1},
+			"completed_at":    bson.M{"$last": "$completed_at"},
+		}}},
+		{{Key: "$facet", Value: bson.M{
+			"count": bson.A{bson.M{"$count": "n"}},
+			"entries": bson.A{
+				bson.M{"$sort": bson.D{{Key: "total", Value: -1}, {Key: "completed_at", Value: 1}}},
+				bson.M{"$skip": (page - 1) * pageSize},
+				bson.M{"$limit": pageSize},
+			},
+		}}},
+	}
+
+	cursor, err := m.ScoresColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Count []struct {
+			N int64 `bson:"n"`
+		} `bson:"count"`
+		Entries []models.LeaderboardEntry `bson:"entries"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]models.LeaderboardEntry, 0)
+	var total int64
+	if len(results) > 0 {
+		entries = append(entries, results[0].Entries...)
+		if len(results[0].Count) > 0 {
+			total = results[0].Count[0].N
+		}
+	}
+	rankEntries(entries, page, pageSize)
+	return entries, total, nil
+}
+
+func rankEntries(entries []models.LeaderboardEntry, page, pageSize int) {
+	for i := range entries {
+		entries[i].Rank = (page-1)*pageSize + i + 1
+	}
+}
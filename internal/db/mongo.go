@@ -3,6 +3,7 @@ package db
 import (
 	"casos-de-codigo-api/internal/models"
 	"context"
+	"errors"
 	"log"
 	"time"
 
@@ -12,6 +13,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var ErrHistoryChanged = errors.New("histórico de SQL alterado por outra requisição")
+
 type MongoManager struct {
 	Client          *mongo.Client
 	Database        *mongo.Database
@@ -19,6 +22,8 @@ type MongoManager struct {
 	CasesColl       *mongo.Collection
 	ProgressionColl *mongo.Collection
 	TelemetryColl   *mongo.Collection
+	ScoresColl      *mongo.Collection
+	LeaderboardColl *mongo.Collection
 }
 
 func NewMongoManager(uri string, dbName string) (*MongoManager, error) {
@@ -44,6 +49,8 @@ func NewMongoManager(uri string, dbName string) (*MongoManager, error) {
 		CasesColl:       db.Collection("cases"),
 		ProgressionColl: db.Collection("progression"),
 		TelemetryColl:   db.Collection("telemetry"),
+		ScoresColl:      db.Collection("scores"),
+		LeaderboardColl: db.Collection("leaderboard_prefs"),
 	}
 
 	if err := manager.createIndexes(); err != nil {
@@ -96,6 +103,23 @@ func (m *MongoManager) createIndexes() error {
 		},
 	}
 
+	scoreIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "case_id", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "case_id", Value: 1},
+				{Key: "public", Value: 1},
+				{Key: "total", Value: -1},
+			},
+		},
+	}
+
 	if _, err := m.UsersColl.Indexes().CreateMany(ctx, userIndexes); err != nil {
 		return err
 	}
@@ -108,6 +132,10 @@ func (m *MongoManager) createIndexes() error {
 		return err
 	}
 
+	if _, err := m.ScoresColl.Indexes().CreateMany(ctx, scoreIndexes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -160,16 +188,38 @@ func (m *MongoManager) FindUserByID(id primitive.ObjectID) (*models.User, error)
 	return &user, nil
 }
 
+// GetCase devolve o caso com as condições já compiladas. A compilação é
+// feita uma vez por versão do caso: nas cargas seguintes só a versão é lida
+// do banco. Um caso com condições inválidas devolve *CaseCompileError.
 func (m *MongoManager) GetCase(caseID string) (*models.Case, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var header struct {
+		Version int `bson:"version"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"version": 1})
+	if err := m.CasesColl.FindOne(ctx, bson.M{"_id": caseID}, opts).Decode(&header); err != nil {
+		return nil, err
+	}
+
+	if cached, ok := compiledCases.get(caseID, header.Version); ok {
+		return cached.load()
+	}
+
 	var caso models.Case
 	err := m.CasesColl.FindOne(ctx, bson.M{"_id": caseID}).Decode(&caso)
 	if err != nil {
 		return nil, err
 	}
-	return &caso, nil
+
+	entry := &compiledCase{caso: &caso}
+	if errs := caso.CompileConditions(); len(errs) > 0 {
+		entry.err = &CaseCompileError{CaseID: caso.ID, Version: caso.Version, Errors: errs}
+		log.Printf("Erro: %v", entry.err)
+	}
+	compiledCases.put(caseID, caso.Version, entry)
+	return entry.load()
 }
 
 func (m *MongoManager) GetAllCases() ([]models.Case, error) {
@@ -227,6 +277,9 @@ func (m *MongoManager) UpsertProgression(p *models.Progression) error {
 	if err == nil && existing.Completed {
 		p.Completed = true
 	}
+	if err == nil {
+		mergeFailedAttempts(p, existing.PuzzleStats)
+	}
 
 	opts := options.Replace().SetUpsert(true)
 
@@ -234,6 +287,25 @@ func (m *MongoManager) UpsertProgression(p *models.Progression) error {
 	return err
 }
 
+// mergeFailedAttempts preserva as tentativas com erro gravadas por
+// RecordFailedAttempt depois que p foi carregada; o ReplaceOne as apagaria.
+func mergeFailedAttempts(p *models.Progression, stored map[string]models.PuzzleStats) {
+	for key, s := range stored {
+		stats, ok := p.PuzzleStats[key]
+		if ok && stats.FailedAttempts >= s.FailedAttempts {
+			continue
+		}
+		if p.PuzzleStats == nil {
+			p.PuzzleStats = map[string]models.PuzzleStats{}
+		}
+		if !ok {
+			stats.StartedAt = s.StartedAt
+		}
+		stats.FailedAttempts = s.FailedAttempts
+		p.PuzzleStats[key] = stats
+	}
+}
+
 func (m *MongoManager) ResetProgression(userID primitive.ObjectID, caseID string, startingPuzzle int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -247,8 +319,27 @@ func (m *MongoManager) ResetProgression(userID primitive.ObjectID, caseID string
 				"current_focus":      "none",
 				"sql_history":        []models.SQLHistoryItem{},
 				"puzzle_checkpoints": bson.M{},
+				"pending_sql":        []models.SQLHistoryItem{},
+				"in_transaction":     false,
+				"diverged":           false,
 				"updated_at":         time.Now(),
 			},
+			"$unset": bson.M{
+				"divergence":        "",
+				"solved_puzzles":    "",
+				"flags":             "",
+				"counters":          "",
+				"inventory":         "",
+				"visited":           "",
+				"story_checkpoints": "",
+				"ending":            "",
+				"outcome":           "",
+				"accusations":       "",
+				"hints_used":        "",
+				"puzzle_stats":      "",
+				"completed_at":      "",
+				"focus_stack":       "",
+			},
 		},
 	)
 	return err
@@ -266,7 +357,7 @@ func (m *MongoManager) SaveTelemetry(event *models.TelemetryEvent) error {
 	return err
 }
 
-func (m *MongoManager) AddSQLHistory(userID primitive.ObjectID, caseID string, item models.SQLHistoryItem) error {
+func (m *MongoManager) AddSQLHistory(userID primitive.ObjectID, caseID string, items ...models.SQLHistoryItem) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -277,13 +368,107 @@ func (m *MongoManager) AddSQLHistory(userID primitive.ObjectID, caseID string, i
 			"case_id": caseID,
 		},
 		bson.M{
-			"$push": bson.M{"sql_history": item},
+			"$push": bson.M{"sql_history": bson.M{"$each": items}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	return err
+}
+
+// TruncateSQLHistory mantém só os primeiros keep itens do histórico, desde
+// que ele ainda tenha expectedLen itens; caso contrário devolve
+// ErrHistoryChanged sem alterar nada.
+func (m *MongoManager) TruncateSQLHistory(userID primitive.ObjectID, caseID string, expectedLen int, keep int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.ProgressionColl.UpdateOne(
+		ctx,
+		bson.M{
+			"user_id":     userID,
+			"case_id":     caseID,
+			"sql_history": bson.M{"$size": expectedLen},
+		},
+		bson.M{
+			"$push": bson.M{"sql_history": bson.M{"$each": bson.A{}, "$slice": keep}},
 			"$set":  bson.M{"updated_at": time.Now()},
 		},
 	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrHistoryChanged
+	}
+	return nil
+}
+
+// MarkDiverged registra a primeira divergência encontrada ao reexecutar o
+// histórico; uma divergência já gravada não é sobrescrita.
+func (m *MongoManager) MarkDiverged(userID primitive.ObjectID, caseID string, divergence *models.Divergence) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.ProgressionColl.UpdateOne(
+		ctx,
+		bson.M{
+			"user_id":  userID,
+			"case_id":  caseID,
+			"diverged": bson.M{"$ne": true},
+		},
+		bson.M{
+			"$set": bson.M{
+				"diverged":   true,
+				"divergence": divergence,
+				"updated_at": time.Now(),
+			},
+		},
+	)
 	return err
 }
 
+// SaveRepairedProgression grava o histórico reparado e limpa a divergência,
+// desde que o histórico ainda tenha expectedLen itens; caso contrário
+// devolve ErrHistoryChanged sem alterar nada.
+func (m *MongoManager) SaveRepairedProgression(p *models.Progression, expectedLen int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.ProgressionColl.UpdateOne(
+		ctx,
+		bson.M{
+			"user_id":     p.UserID,
+			"case_id":     p.CaseID,
+			"sql_history": bson.M{"$size": expectedLen},
+		},
+		bson.M{
+			"$set": bson.M{
+				"current_focus":      p.CurrentFocus,
+				"focus_stack":        p.FocusStack,
+				"sql_history":        p.SQLHistory,
+				"puzzle_checkpoints": p.PuzzleCheckpoints,
+				"solved_puzzles":     p.Solved,
+				"flags":              p.Flags,
+				"counters":           p.Counters,
+				"inventory":          p.Inventory,
+				"visited":            p.Visited,
+				"pending_sql":        []models.SQLHistoryItem{},
+				"in_transaction":     false,
+				"diverged":           false,
+				"updated_at":         time.Now(),
+			},
+			"$unset": bson.M{"divergence": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrHistoryChanged
+	}
+	return nil
+}
+
 func (m *MongoManager) GetUserProgressions(userID primitive.ObjectID) ([]models.Progression, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type schemaObject struct {
+	kind  string
+	name  string
+	table string
+	sql   string
+}
+
+// StateChecksum resume o conteúdo do sandbox visível no puzzle informado em
+// um hash: nome de cada objeto do schema e, para as tabelas, colunas e
+// linhas. Tabelas de puzzles posteriores ficam de fora, já que a reexecução
+// parte da imagem base do puzzle atual. Com relógio e random()
+// determinísticos, o mesmo histórico sempre produz o mesmo valor.
+func (s *Sandbox) StateChecksum(ctx context.Context, caso *models.Case, puzzle int) (string, error) {
+	hidden := map[string]bool{}
+	for _, schema := range caso.Schemas {
+		if schema.Puzzle > puzzle {
+			hidden[strings.ToLower(schema.TableName)] = true
+		}
+	}
+
+	h := sha256.New()
+
+	err := s.Trusted(func() error {
+		objects, err := schemaObjects(ctx, s.DB)
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range objects {
+			if hidden[strings.ToLower(obj.table)] {
+				continue
+			}
+			fmt.Fprintf(h, "%s\x1f%s\x1e", obj.kind, obj.name)
+			if obj.kind != "table" {
+				continue
+			}
+			if err := hashTableRows(ctx, s.DB, obj, h.Write); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func schemaObjects(ctx context.Context, db *sql.DB) ([]schemaObject, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT type, name, tbl_name, COALESCE(sql, '')
+		FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%'
+		ORDER BY type, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := make([]schemaObject, 0)
+	for rows.Next() {
+		var obj schemaObject
+		if err := rows.Scan(&obj.kind, &obj.name, &obj.table, &obj.sql); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, rows.Err()
+}
+
+// hashTableRows percorre a tabela em ordem de rowid; tabelas WITHOUT ROWID
+// já são lidas na ordem da chave primária.
+func hashTableRows(ctx context.Context, db *sql.DB, obj schemaObject, write func([]byte) (int, error)) error {
+	quoted := `"` + strings.ReplaceAll(obj.name, `"`, `""`) + `"`
+	query := "SELECT * FROM " + quoted + " ORDER BY rowid"
+	if strings.Contains(strings.ToUpper(obj.sql), "WITHOUT ROWID") {
+		query = "SELECT * FROM " + quoted
+	}
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	write([]byte(strings.Join(columns, "\x1f") + "\x1e"))
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for _, v := range values {
+			write([]byte(fmt.Sprintf("%T:%v\x1f", v, v)))
+		}
+		write([]byte{0x1e})
+	}
+	return rows.Err()
+}
+
+// markDivergence guarda só a primeira divergência: depois dela todo estado
+// seguinte também difere do gravado.
+func (s *Sandbox) markDivergence(index int, item models.SQLHistoryItem, reason string) {
+	if s.divergence != nil {
+		return
+	}
+	s.divergence = &models.Divergence{
+		Index:      index,
+		Query:      item.Query,
+		Reason:     reason,
+		DetectedAt: time.Now(),
+	}
+}
+
+// Divergence devolve a divergência encontrada ao reexecutar o histórico,
+// ou nil se o banco reproduziu o estado que o jogador viu.
+func (s *Sandbox) Divergence() *models.Divergence {
+	return s.divergence
+}
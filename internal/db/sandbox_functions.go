@@ -0,0 +1,386 @@
+package db
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"casos-de-codigo-api/internal/textdist"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+type sandboxFunction struct {
+	name string
+	impl interface{}
+}
+
+type functionBuilder func(params map[string]string) (interface{}, error)
+
+// functionBuiltins é a biblioteca de funções que um caso pode expor no SQL.
+// Todas são puras, tratam NULL devolvendo NULL e recebem os parâmetros do
+// caso (direção da cifra, sal do hash etc.) na hora do registro.
+var functionBuiltins = map[string]functionBuilder{
+	"caesar":      buildCaesar,
+	"vigenere":    buildVigenere,
+	"reverse":     buildReverse,
+	"base64":      buildBase64,
+	"levenshtein": buildLevenshtein,
+	"euclidean":   buildEuclidean,
+	"hash":        buildHash,
+	"lookup":      buildLookup,
+}
+
+var functionNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedFunctionNames não podem ser sobrescritas pelo caso: o motor depende
+// delas para normalizar comandos e rodar validações.
+var reservedFunctionNames = map[string]bool{
+	"lower": true, "upper": true, "like": true, "glob": true, "count": true,
+	"sum": true, "avg": true, "min": true, "max": true, "total": true,
+	"length": true, "substr": true, "trim": true, "replace": true, "abs": true,
+	"round": true, "coalesce": true, "ifnull": true, "typeof": true,
+	"date": true, "time": true, "datetime": true, "julianday": true,
+	"strftime": true, "unixepoch": true, "random": true, "randomblob": true,
+	"casefold":     true,
+	"group_concat": true, "instr": true, "printf": true, "format": true,
+}
+
+// warnedFunctions evita repetir o mesmo aviso a cada sandbox aberto.
+var warnedFunctions sync.Map
+
+func warnFunction(caso *models.Case, name string, reason string) {
+	key := fmt.Sprintf("%s:%d:%s", caso.ID, caso.Version, name)
+	if _, seen := warnedFunctions.LoadOrStore(key, true); !seen {
+		log.Printf("Aviso: Função SQL %q do caso %s ignorada: %s", name, caso.ID, reason)
+	}
+}
+
+// compileFunctions monta as funções declaradas pelo caso. Entradas sem
+// Builtin são apenas documentação; definições inválidas são ignoradas com
+// um aviso para não derrubar o caso inteiro.
+func compileFunctions(caso *models.Case) []sandboxFunction {
+	functions := make([]sandboxFunction, 0, len(caso.SQLFunctions))
+
+	for _, def := range caso.SQLFunctions {
+		if def.Builtin == "" {
+			continue
+		}
+
+		name := strings.ToLower(def.Name)
+		switch {
+		case !functionNameRe.MatchString(def.Name):
+			warnFunction(caso, def.Name, "nome inválido")
+			continue
+		case reservedFunctionNames[name] || blockedFunctions[name]:
+			warnFunction(caso, def.Name, "nome reservado")
+			continue
+		}
+
+		builder, ok := functionBuiltins[strings.ToLower(def.Builtin)]
+		if !ok {
+			warnFunction(caso, def.Name, fmt.Sprintf("builtin %q desconhecido", def.Builtin))
+			continue
+		}
+
+		impl, err := builder(def.Params)
+		if err != nil {
+			warnFunction(caso, def.Name, err.Error())
+			continue
+		}
+
+		functions = append(functions, sandboxFunction{name: def.Name, impl: impl})
+	}
+
+	return functions
+}
+
+// casefold é o LOWER usado pelo NormalizeSQL: converte também letras fora
+// do ASCII ('JOSÉ' vira 'josé') e, como LOWER, devolve números como texto.
+func casefold(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return strings.ToLower(t)
+	case []byte:
+		if t == nil {
+			return nil
+		}
+		return strings.ToLower(string(t))
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return sqliteReal(t)
+	}
+	return nil
+}
+
+// sqliteReal formata um REAL como o SQLite faz ao convertê-lo em texto.
+func sqliteReal(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	s := strconv.FormatFloat(f, 'g', 15, 64)
+	if strings.ContainsAny(s, ".N") {
+		return s
+	}
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		return s[:i] + ".0" + s[i:]
+	}
+	return s + ".0"
+}
+
+func decodeDirection(params map[string]string) (bool, error) {
+	switch strings.ToLower(params["direction"]) {
+	case "", "decode":
+		return true, nil
+	case "encode":
+		return false, nil
+	}
+	return false, fmt.Errorf("direction deve ser decode ou encode")
+}
+
+func textArg(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return t, true
+	case []byte:
+		// o go-sqlite3 entrega NULL como []byte nil
+		if t == nil {
+			return "", false
+		}
+		return string(t), true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	default:
+		return fmt.Sprintf("%v", t), true
+	}
+}
+
+func numberArg(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func shiftLetter(r rune, shift int) rune {
+	var base rune
+	switch {
+	case r >= 'a' && r <= 'z':
+		base = 'a'
+	case r >= 'A' && r <= 'Z':
+		base = 'A'
+	default:
+		return r
+	}
+	return base + rune(((int(r-base)+shift)%26+26)%26)
+}
+
+// DECIFRAR(texto, deslocamento): cifra de César sobre as letras A-Z.
+func buildCaesar(params map[string]string) (interface{}, error) {
+	decode, err := decodeDirection(params)
+	if err != nil {
+		return nil, err
+	}
+	return func(text, key interface{}) interface{} {
+		s, ok := textArg(text)
+		k, okKey := numberArg(key)
+		if !ok || !okKey {
+			return nil
+		}
+		shift := int(k) % 26
+		if decode {
+			shift = -shift
+		}
+		return strings.Map(func(r rune) rune { return shiftLetter(r, shift) }, s)
+	}, nil
+}
+
+// vigenere(texto, chave): cada letra da chave define o deslocamento.
+func buildVigenere(params map[string]string) (interface{}, error) {
+	decode, err := decodeDirection(params)
+	if err != nil {
+		return nil, err
+	}
+	return func(text, key interface{}) interface{} {
+		s, ok := textArg(text)
+		k, okKey := textArg(key)
+		if !ok || !okKey {
+			return nil
+		}
+		shifts := make([]int, 0, len(k))
+		for _, r := range strings.ToUpper(k) {
+			if r >= 'A' && r <= 'Z' {
+				shifts = append(shifts, int(r-'A'))
+			}
+		}
+		if len(shifts) == 0 {
+			return s
+		}
+		i := 0
+		return strings.Map(func(r rune) rune {
+			if !unicode.IsLetter(r) || r > unicode.MaxASCII {
+				return r
+			}
+			shift := shifts[i%len(shifts)]
+			i++
+			if decode {
+				shift = -shift
+			}
+			return shiftLetter(r, shift)
+		}, s)
+	}, nil
+}
+
+func buildReverse(params map[string]string) (interface{}, error) {
+	return func(text interface{}) interface{} {
+		s, ok := textArg(text)
+		if !ok {
+			return nil
+		}
+		runes := []rune(s)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes)
+	}, nil
+}
+
+func buildBase64(params map[string]string) (interface{}, error) {
+	decode, err := decodeDirection(params)
+	if err != nil {
+		return nil, err
+	}
+	return func(text interface{}) interface{} {
+		s, ok := textArg(text)
+		if !ok {
+			return nil
+		}
+		if !decode {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		}
+		out, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil
+		}
+		return string(out)
+	}, nil
+}
+
+// maxLevenshteinRunes limita DISTANCIA: o cálculo roda dentro de um callback
+// Go, que o timeout da consulta não consegue interromper.
+const maxLevenshteinRunes = 256
+
+// DISTANCIA(a, b) entre textos: número de edições para transformar um no
+// outro, ou NULL se algum deles passar de maxLevenshteinRunes caracteres.
+func buildLevenshtein(params map[string]string) (interface{}, error) {
+	return func(a, b interface{}) interface{} {
+		sa, okA := textArg(a)
+		sb, okB := textArg(b)
+		if !okA || !okB {
+			return nil
+		}
+		if utf8.RuneCountInString(sa) > maxLevenshteinRunes || utf8.RuneCountInString(sb) > maxLevenshteinRunes {
+			return nil
+		}
+		return int64(textdist.Levenshtein(sa, sb))
+	}, nil
+}
+
+// distância euclidiana entre (x1, y1) e (x2, y2), arredondada a 2 casas
+// para o resultado não depender de ruído de ponto flutuante.
+func buildEuclidean(params map[string]string) (interface{}, error) {
+	return func(x1, y1, x2, y2 interface{}) interface{} {
+		coords := make([]float64, 4)
+		for i, v := range []interface{}{x1, y1, x2, y2} {
+			n, ok := numberArg(v)
+			if !ok {
+				return nil
+			}
+			coords[i] = n
+		}
+		d := math.Hypot(coords[2]-coords[0], coords[3]-coords[1])
+		return math.Round(d*100) / 100
+	}, nil
+}
+
+// HASH_EVIDENCIA(x): hash hexadecimal com sal do caso, opcionalmente cortado.
+func buildHash(params map[string]string) (interface{}, error) {
+	var newHash func() hash.Hash
+	switch strings.ToLower(params["algorithm"]) {
+	case "", "sha256":
+		newHash = sha256.New
+	case "sha1":
+		newHash = sha1.New
+	case "md5":
+		newHash = md5.New
+	default:
+		return nil, fmt.Errorf("algorithm %q não suportado", params["algorithm"])
+	}
+
+	length := 0
+	if v := params["length"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("length deve ser um inteiro positivo")
+		}
+		length = n
+	}
+	salt := params["salt"]
+
+	return func(value interface{}) interface{} {
+		s, ok := textArg(value)
+		if !ok {
+			return nil
+		}
+		h := newHash()
+		h.Write([]byte(salt + s))
+		sum := strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+		if length > 0 && length < len(sum) {
+			sum = sum[:length]
+		}
+		return sum
+	}, nil
+}
+
+// lookup(chave): tabela de códigos definida nos parâmetros do caso.
+func buildLookup(params map[string]string) (interface{}, error) {
+	if len(params) == 0 {
+		return nil, fmt.Errorf("lookup precisa de ao menos um par chave/valor")
+	}
+	table := make(map[string]string, len(params))
+	for k, v := range params {
+		table[strings.ToUpper(k)] = v
+	}
+	return func(key interface{}) interface{} {
+		s, ok := textArg(key)
+		if !ok {
+			return nil
+		}
+		if v, found := table[strings.ToUpper(strings.TrimSpace(s))]; found {
+			return v
+		}
+		return nil
+	}, nil
+}
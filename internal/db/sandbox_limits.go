@@ -0,0 +1,47 @@
+package db
+
+import (
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type SandboxLimits struct {
+	QueryTimeout      time.Duration
+	MaxRows           int
+	MaxCellBytes      int
+	MaxLength         int
+	MaxSQLLength      int
+	MaxExprDepth      int
+	MaxCompoundSelect int
+	MaxStatements     int
+}
+
+func DefaultSandboxLimits() SandboxLimits {
+	return SandboxLimits{
+		QueryTimeout:      2 * time.Second,
+		MaxRows:           500,
+		MaxCellBytes:      4 << 10,
+		MaxLength:         1 << 20,
+		MaxSQLLength:      1 << 20,
+		MaxExprDepth:      250,
+		MaxCompoundSelect: 50,
+		MaxStatements:     20,
+	}
+}
+
+func (l SandboxLimits) apply(conn *sqlite3.SQLiteConn) {
+	if l.MaxLength > 0 {
+		conn.SetLimit(sqlite3.SQLITE_LIMIT_LENGTH, l.MaxLength)
+	}
+	if l.MaxSQLLength > 0 {
+		conn.SetLimit(sqlite3.SQLITE_LIMIT_SQL_LENGTH, l.MaxSQLLength)
+	}
+	if l.MaxExprDepth > 0 {
+		conn.SetLimit(sqlite3.SQLITE_LIMIT_EXPR_DEPTH, l.MaxExprDepth)
+	}
+	if l.MaxCompoundSelect > 0 {
+		conn.SetLimit(sqlite3.SQLITE_LIMIT_COMPOUND_SELECT, l.MaxCompoundSelect)
+	}
+	conn.SetLimit(sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+}
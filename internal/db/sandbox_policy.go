@@ -0,0 +1,195 @@
+package db
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type PolicyDenial struct {
+	Action  string
+	Target  string
+	Message string
+}
+
+// SandboxPolicy é consultada pelo authorizer do SQLite a cada comando
+// preparado na conexão. Em modo confiável (carga do schema do caso e
+// validações escritas pelo autor) tudo é liberado.
+type SandboxPolicy struct {
+	mu           sync.Mutex
+	trusted      bool
+	restrictions PolicyRestrictions
+	tables       map[string]bool
+	denial       *PolicyDenial
+}
+
+// PolicyRestrictions são as regras do puzzle atual aplicadas ao SQL do
+// jogador. AllowedTables vazio libera todas as tabelas.
+type PolicyRestrictions struct {
+	AllowedTables []string
+	AllowIndexes  bool
+	AllowViews    bool
+}
+
+const schemaDeniedMessage = "A estrutura do banco é evidência: criar, apagar ou alterar tabelas não é permitido nesta investigação."
+
+// readOnlyPragmas é a lista única de PRAGMAs liberados ao jogador, usada pelo
+// authorizer e pelo classificador do engine. true marca as consultas, que
+// aceitam argumento; false marca as configurações, que só podem ser lidas.
+var readOnlyPragmas = map[string]bool{
+	"table_info":        true,
+	"table_xinfo":       true,
+	"table_list":        true,
+	"index_list":        true,
+	"index_info":        true,
+	"index_xinfo":       true,
+	"foreign_key_list":  true,
+	"collation_list":    true,
+	"function_list":     true,
+	"database_list":     true,
+	"compile_options":   true,
+	"foreign_key_check": true,
+	"integrity_check":   true,
+	"quick_check":       true,
+
+	"foreign_keys":   false,
+	"user_version":   false,
+	"schema_version": false,
+	"application_id": false,
+	"encoding":       false,
+	"page_size":      false,
+	"page_count":     false,
+	"freelist_count": false,
+	"journal_mode":   false,
+	"auto_vacuum":    false,
+}
+
+// ReadOnlyPragma diz se o PRAGMA name só lê o banco. Com argumento (entre
+// parênteses ou depois de =), só as consultas continuam liberadas.
+func ReadOnlyPragma(name string, hasArgument bool) bool {
+	query, ok := readOnlyPragmas[strings.ToLower(name)]
+	return ok && (query || !hasArgument)
+}
+
+var blockedFunctions = map[string]bool{
+	"load_extension": true,
+	"readfile":       true,
+	"writefile":      true,
+	"edit":           true,
+	"fts3_tokenizer": true,
+}
+
+func (p *SandboxPolicy) SetTrusted(trusted bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trusted = trusted
+}
+
+func (p *SandboxPolicy) Restrict(r PolicyRestrictions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.restrictions = r
+	p.tables = nil
+	if len(r.AllowedTables) > 0 {
+		p.tables = make(map[string]bool, len(r.AllowedTables))
+		for _, t := range r.AllowedTables {
+			p.tables[strings.ToLower(t)] = true
+		}
+	}
+}
+
+// TakeDenial devolve e limpa a última negação registrada pelo authorizer.
+func (p *SandboxPolicy) TakeDenial() *PolicyDenial {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := p.denial
+	p.denial = nil
+	return d
+}
+
+func (p *SandboxPolicy) authorize(op int, arg1, arg2, arg3 string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.trusted {
+		return sqlite3.SQLITE_OK
+	}
+
+	switch op {
+	case sqlite3.SQLITE_ATTACH, sqlite3.SQLITE_DETACH:
+		return p.deny("attach", arg1, "Por segurança, não é possível anexar ou desanexar outros bancos de dados neste terminal.")
+
+	case sqlite3.SQLITE_PRAGMA:
+		if ReadOnlyPragma(arg1, arg2 != "") {
+			return sqlite3.SQLITE_OK
+		}
+		return p.deny("pragma", arg1, "Este PRAGMA altera a configuração do banco e está bloqueado no terminal de investigação.")
+
+	case sqlite3.SQLITE_FUNCTION:
+		if blockedFunctions[strings.ToLower(arg2)] {
+			return p.deny("function", arg2, "A função "+arg2+" não está disponível no terminal de investigação.")
+		}
+
+	case sqlite3.SQLITE_READ, sqlite3.SQLITE_INSERT, sqlite3.SQLITE_UPDATE, sqlite3.SQLITE_DELETE:
+		if p.tables != nil && !p.tables[strings.ToLower(arg1)] && !strings.HasPrefix(strings.ToLower(arg1), "sqlite_") {
+			return p.deny("table", arg1, "A tabela "+arg1+" não faz parte desta etapa da investigação.")
+		}
+
+	case sqlite3.SQLITE_CREATE_INDEX, sqlite3.SQLITE_REINDEX:
+		if !p.restrictions.AllowIndexes {
+			return p.deny("schema", arg1, schemaDeniedMessage)
+		}
+
+	case sqlite3.SQLITE_CREATE_VIEW:
+		if !p.restrictions.AllowViews {
+			return p.deny("schema", arg1, schemaDeniedMessage)
+		}
+
+	case sqlite3.SQLITE_CREATE_TABLE, sqlite3.SQLITE_CREATE_TEMP_TABLE,
+		sqlite3.SQLITE_CREATE_TEMP_INDEX, sqlite3.SQLITE_CREATE_TEMP_VIEW,
+		sqlite3.SQLITE_CREATE_TRIGGER, sqlite3.SQLITE_CREATE_TEMP_TRIGGER,
+		sqlite3.SQLITE_CREATE_VTABLE,
+		sqlite3.SQLITE_DROP_TABLE, sqlite3.SQLITE_DROP_TEMP_TABLE,
+		sqlite3.SQLITE_DROP_INDEX, sqlite3.SQLITE_DROP_TEMP_INDEX,
+		sqlite3.SQLITE_DROP_VIEW, sqlite3.SQLITE_DROP_TEMP_VIEW,
+		sqlite3.SQLITE_DROP_TRIGGER, sqlite3.SQLITE_DROP_TEMP_TRIGGER,
+		sqlite3.SQLITE_DROP_VTABLE,
+		sqlite3.SQLITE_ALTER_TABLE, sqlite3.SQLITE_ANALYZE:
+		return p.deny("schema", arg1, schemaDeniedMessage)
+	}
+
+	return sqlite3.SQLITE_OK
+}
+
+func (p *SandboxPolicy) deny(action, target, message string) int {
+	if p.denial == nil {
+		p.denial = &PolicyDenial{Action: action, Target: target, Message: message}
+	}
+	return sqlite3.SQLITE_DENY
+}
+
+type Sandbox struct {
+	*sql.DB
+	Policy *SandboxPolicy
+	random *sandboxRandom
+
+	divergence *models.Divergence
+}
+
+// SeedStatement fixa a sequência de random() para o comando na posição
+// index do histórico da progressão.
+func (s *Sandbox) SeedStatement(seed int64, index int) {
+	s.random.reseed(seed, index)
+}
+
+// Trusted executa fn com o authorizer liberado, para SQL escrito pelo autor
+// do caso.
+func (s *Sandbox) Trusted(fn func() error) error {
+	s.Policy.SetTrusted(true)
+	defer s.Policy.SetTrusted(false)
+	return fn()
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestReadOnlyPragma(t *testing.T) {
+	tests := []struct {
+		name        string
+		hasArgument bool
+		want        bool
+	}{
+		{"table_info", true, true},
+		{"INTEGRITY_CHECK", false, true},
+		{"quick_check", true, true},
+		{"foreign_keys", false, true},
+		{"foreign_keys", true, false},
+		{"journal_mode", true, false},
+		{"writable_schema", false, false},
+		{"optimize", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := ReadOnlyPragma(tt.name, tt.hasArgument); got != tt.want {
+			t.Errorf("ReadOnlyPragma(%q, %v) = %v, quer %v", tt.name, tt.hasArgument, got, tt.want)
+		}
+	}
+}
+
+func TestSandboxPolicyAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     int
+		arg1   string
+		arg2   string
+		action string
+	}{
+		{"leitura liberada", sqlite3.SQLITE_READ, "suspeitos", "nome", ""},
+		{"tabela de outra etapa", sqlite3.SQLITE_READ, "cofre", "senha", "table"},
+		{"tabela interna", sqlite3.SQLITE_READ, "sqlite_master", "sql", ""},
+		{"update de outra etapa", sqlite3.SQLITE_UPDATE, "COFRE", "senha", "table"},
+		{"attach", sqlite3.SQLITE_ATTACH, "x.db", "", "attach"},
+		{"detach", sqlite3.SQLITE_DETACH, "x", "", "attach"},
+		{"pragma de consulta", sqlite3.SQLITE_PRAGMA, "table_info", "suspeitos", ""},
+		{"integrity_check", sqlite3.SQLITE_PRAGMA, "integrity_check", "", ""},
+		{"leitura de configuração", sqlite3.SQLITE_PRAGMA, "foreign_keys", "", ""},
+		{"escrita de configuração", sqlite3.SQLITE_PRAGMA, "foreign_keys", "OFF", "pragma"},
+		{"pragma perigoso", sqlite3.SQLITE_PRAGMA, "writable_schema", "1", "pragma"},
+		{"função bloqueada", sqlite3.SQLITE_FUNCTION, "", "load_extension", "function"},
+		{"função comum", sqlite3.SQLITE_FUNCTION, "", "upper", ""},
+		{"create table", sqlite3.SQLITE_CREATE_TABLE, "notas", "", "schema"},
+		{"drop table", sqlite3.SQLITE_DROP_TABLE, "suspeitos", "", "schema"},
+		{"alter table", sqlite3.SQLITE_ALTER_TABLE, "main", "suspeitos", "schema"},
+		{"trigger", sqlite3.SQLITE_CREATE_TRIGGER, "log", "suspeitos", "schema"},
+		{"índice sem permissão", sqlite3.SQLITE_CREATE_INDEX, "idx", "suspeitos", "schema"},
+		{"view sem permissão", sqlite3.SQLITE_CREATE_VIEW, "presos", "", "schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &SandboxPolicy{}
+			p.Restrict(PolicyRestrictions{AllowedTables: []string{"Suspeitos"}})
+
+			want := sqlite3.SQLITE_OK
+			if tt.action != "" {
+				want = sqlite3.SQLITE_DENY
+			}
+			if got := p.authorize(tt.op, tt.arg1, tt.arg2, ""); got != want {
+				t.Fatalf("authorize = %d, quer %d", got, want)
+			}
+
+			denial := p.TakeDenial()
+			switch {
+			case tt.action == "" && denial != nil:
+				t.Errorf("negação inesperada: %+v", denial)
+			case tt.action != "" && (denial == nil || denial.Action != tt.action || denial.Message == ""):
+				t.Errorf("negação = %+v, quer ação %s", denial, tt.action)
+			}
+		})
+	}
+}
+
+func TestSandboxPolicyOptions(t *testing.T) {
+	p := &SandboxPolicy{}
+	p.Restrict(PolicyRestrictions{AllowIndexes: true, AllowViews: true})
+
+	if p.authorize(sqlite3.SQLITE_CREATE_INDEX, "idx", "suspeitos", "") != sqlite3.SQLITE_OK {
+		t.Error("AllowIndexes deveria liberar CREATE INDEX")
+	}
+	if p.authorize(sqlite3.SQLITE_CREATE_VIEW, "presos", "", "") != sqlite3.SQLITE_OK {
+		t.Error("AllowViews deveria liberar CREATE VIEW")
+	}
+	if p.authorize(sqlite3.SQLITE_READ, "qualquer", "x", "") != sqlite3.SQLITE_OK {
+		t.Error("sem AllowedTables todas as tabelas deveriam ser liberadas")
+	}
+
+	p.SetTrusted(true)
+	if p.authorize(sqlite3.SQLITE_DROP_TABLE, "suspeitos", "", "") != sqlite3.SQLITE_OK {
+		t.Error("o modo confiável deveria liberar tudo")
+	}
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// sandboxRandom substitui random() e randomblob() do SQLite por um gerador
+// semeado a cada comando, para que a reexecução do histórico produza
+// exatamente os mesmos valores.
+type sandboxRandom struct {
+	mu      sync.Mutex
+	rng     *rand.Rand
+	maxBlob int
+}
+
+func newSandboxRandom(maxBlob int) *sandboxRandom {
+	return &sandboxRandom{rng: rand.New(rand.NewPCG(0, 0)), maxBlob: maxBlob}
+}
+
+func (r *sandboxRandom) reseed(seed int64, index int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rng = rand.New(rand.NewPCG(uint64(seed), uint64(index)))
+}
+
+func (r *sandboxRandom) random() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(r.rng.Uint64())
+}
+
+func (r *sandboxRandom) randomBlob(size interface{}) []byte {
+	n := 1
+	if v, ok := size.(int64); ok && v > 1 {
+		n = int(v)
+	}
+	if r.maxBlob > 0 && n > r.maxBlob {
+		n = r.maxBlob
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blob := make([]byte, n)
+	for i := range blob {
+		blob[i] = byte(r.rng.Uint32())
+	}
+	return blob
+}
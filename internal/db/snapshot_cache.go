@@ -0,0 +1,132 @@
+package db
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+const defaultSnapshotCacheBytes = 64 << 20
+
+type Snapshot struct {
+	CaseID  string
+	Version int
+	Puzzle  int
+	Applied int
+	Digest  string
+	Image   []byte
+}
+
+type snapshotEntry struct {
+	key      string
+	snapshot *Snapshot
+}
+
+// SnapshotCache guarda imagens serializadas de bancos sandbox em uma LRU
+// limitada pelo total de bytes das imagens.
+type SnapshotCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	used     int
+	lru      *list.List
+	entries  map[string]*list.Element
+	versions map[string]int
+}
+
+func NewSnapshotCache(maxBytes int) *SnapshotCache {
+	return &SnapshotCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		versions: map[string]int{},
+	}
+}
+
+func (c *SnapshotCache) Get(key string) (*Snapshot, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*snapshotEntry).snapshot, true
+}
+
+func (c *SnapshotCache) Put(key string, snap *Snapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(snap.Image) > c.maxBytes {
+		return
+	}
+	if v, ok := c.versions[snap.CaseID]; ok && v != snap.Version {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+
+	el := c.lru.PushFront(&snapshotEntry{key: key, snapshot: snap})
+	c.entries[key] = el
+	c.used += len(snap.Image)
+
+	for c.used > c.maxBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeElement(oldest)
+	}
+}
+
+func (c *SnapshotCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// SyncCaseVersion descarta todas as imagens de um caso quando a versão
+// carregada do Mongo difere da última vista pelo cache.
+func (c *SnapshotCache) SyncCaseVersion(caseID string, version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.versions[caseID]; ok && v == version {
+		return
+	}
+	c.versions[caseID] = version
+
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*snapshotEntry).snapshot.CaseID == caseID {
+			c.removeElement(el)
+		}
+		el = next
+	}
+}
+
+func (c *SnapshotCache) removeElement(el *list.Element) {
+	entry := el.Value.(*snapshotEntry)
+	c.lru.Remove(el)
+	delete(c.entries, entry.key)
+	c.used -= len(entry.snapshot.Image)
+}
+
+// historyDigest encadeia os hashes das queries do histórico, de modo que um
+// snapshot só é reaproveitado se o prefixo aplicado continuar idêntico.
+func historyDigest(history []models.SQLHistoryItem) string {
+	h := sha256.New()
+	for _, item := range history {
+		h.Write([]byte(replayQuery(item)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -2,83 +2,362 @@ package db
 
 import (
 	"casos-de-codigo-api/internal/models"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
 	"log"
-	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
-type SQLiteFactory struct{}
+type SQLiteFactory struct {
+	Snapshots *SnapshotCache
+	Limits    SandboxLimits
+	driver    *sqlite3.SQLiteDriver
+}
 
 func NewSQLiteFactory() *SQLiteFactory {
-	return &SQLiteFactory{}
+	return &SQLiteFactory{
+		Snapshots: NewSnapshotCache(defaultSnapshotCacheBytes),
+		Limits:    DefaultSandboxLimits(),
+		driver:    &sqlite3.SQLiteDriver{},
+	}
+}
+
+type sandboxConnector struct {
+	factory   *SQLiteFactory
+	policy    *SandboxPolicy
+	random    *sandboxRandom
+	functions []sandboxFunction
 }
 
-func (f *SQLiteFactory) CreateInMemoryDB(caso *models.Case, progression *models.Progression) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", ":memory:")
+func (c *sandboxConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.factory.driver.Open(":memory:")
 	if err != nil {
 		return nil, err
 	}
+	sqliteConn := conn.(*sqlite3.SQLiteConn)
+	if err := c.factory.configureConn(sqliteConn, c); err != nil {
+		sqliteConn.Close()
+		return nil, err
+	}
+	return sqliteConn, nil
+}
+
+func (c *sandboxConnector) Driver() driver.Driver {
+	return c.factory.driver
+}
+
+func (f *SQLiteFactory) configureConn(conn *sqlite3.SQLiteConn, c *sandboxConnector) error {
+	f.Limits.apply(conn)
+
+	if _, err := conn.Exec("PRAGMA case_sensitive_like = OFF", nil); err != nil {
+		return err
+	}
+
+	if err := conn.RegisterFunc("random", c.random.random, false); err != nil {
+		return err
+	}
+	if err := conn.RegisterFunc("randomblob", c.random.randomBlob, false); err != nil {
+		return err
+	}
+	if err := conn.RegisterFunc("casefold", casefold, true); err != nil {
+		return err
+	}
+
+	for _, fn := range c.functions {
+		if err := conn.RegisterFunc(fn.name, fn.impl, true); err != nil {
+			return fmt.Errorf("registrar função %s: %w", fn.name, err)
+		}
+	}
+
+	conn.RegisterAuthorizer(c.policy.authorize)
+	return nil
+}
+
+// openSandbox abre um banco em memória preso a uma única conexão: com
+// ":memory:" cada conexão nova do pool seria um banco vazio diferente.
+func (f *SQLiteFactory) openSandbox(functions []sandboxFunction) *Sandbox {
+	policy := &SandboxPolicy{}
+	random := newSandboxRandom(f.Limits.MaxLength)
+	db := sql.OpenDB(&sandboxConnector{factory: f, policy: policy, random: random, functions: functions})
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	return &Sandbox{DB: db, Policy: policy, random: random}
+}
+
+func (f *SQLiteFactory) CreateInMemoryDB(caso *models.Case, progression *models.Progression) (*Sandbox, error) {
+	f.Snapshots.SyncCaseVersion(caso.ID, caso.Version)
+
+	functions := compileFunctions(caso)
+	sb := f.openSandbox(functions)
+	history := progression.EffectiveHistory()
+
+	if snap, ok := f.Snapshots.Get(progressionSnapshotKey(progression)); ok && f.snapshotMatches(snap, caso, progression) {
+		if err := restoreImage(sb.DB, snap.Image); err == nil {
+			f.replayHistory(sb, caso, progression, history, snap.Applied)
+			if snap.Applied < len(history) && (sb.divergence == nil || progression.Diverged) {
+				f.StoreSnapshot(caso, progression, sb, history)
+			}
+			return sb, nil
+		}
+		log.Printf("Aviso: Falha ao restaurar snapshot da progressão, reconstruindo")
+		sb.Close()
+		sb = f.openSandbox(functions)
+	}
+
+	if err := sb.Trusted(func() error {
+		return f.loadBaseImage(sb.DB, caso, progression.SchemaPuzzle())
+	}); err != nil {
+		sb.Close()
+		return nil, err
+	}
+
+	f.replayHistory(sb, caso, progression, history, 0)
+	// uma progressão já marcada como divergente continua do estado
+	// reconstruído até o reparo, então ele pode ir para o cache
+	if len(history) > 0 && (sb.divergence == nil || progression.Diverged) {
+		f.StoreSnapshot(caso, progression, sb, history)
+	}
+
+	return sb, nil
+}
+
+// StoreSnapshot guarda o estado atual do sandbox como ponto de partida da
+// progressão, válido enquanto o histórico aplicado for o mesmo.
+func (f *SQLiteFactory) StoreSnapshot(caso *models.Case, progression *models.Progression, sb *Sandbox, history []models.SQLHistoryItem) {
+	var image []byte
+	err := sb.Trusted(func() error {
+		var err error
+		image, err = serializeImage(sb.DB)
+		return err
+	})
+	if err != nil {
+		log.Printf("Aviso: Falha ao serializar snapshot: %v", err)
+		return
+	}
+
+	f.Snapshots.Put(progressionSnapshotKey(progression), &Snapshot{
+		CaseID:  caso.ID,
+		Version: caso.Version,
+		Puzzle:  progression.SchemaPuzzle(),
+		Applied: len(history),
+		Digest:  historyDigest(history),
+		Image:   image,
+	})
+}
+
+func (f *SQLiteFactory) snapshotMatches(snap *Snapshot, caso *models.Case, progression *models.Progression) bool {
+	if snap.CaseID != caso.ID || snap.Version != caso.Version || snap.Puzzle != progression.SchemaPuzzle() {
+		return false
+	}
+	history := progression.EffectiveHistory()
+	if snap.Applied > len(history) {
+		return false
+	}
+	return snap.Digest == historyDigest(history[:snap.Applied])
+}
+
+func (f *SQLiteFactory) loadBaseImage(db *sql.DB, caso *models.Case, puzzle int) error {
+	key := baseSnapshotKey(caso, puzzle)
+
+	if snap, ok := f.Snapshots.Get(key); ok {
+		if err := restoreImage(db, snap.Image); err == nil {
+			return nil
+		}
+		f.Snapshots.Delete(key)
+	}
 
 	for _, schema := range caso.Schemas {
-		if schema.Puzzle <= progression.CurrentPuzzle {
-			_, err = db.Exec(schema.CreateSQL)
-			if err != nil {
-				db.Close()
-				return nil, err
+		if schema.Puzzle <= puzzle {
+			if _, err := db.Exec(schema.CreateSQL); err != nil {
+				return err
 			}
 
 			if schema.InsertSQL != "" {
-				_, err = db.Exec(schema.InsertSQL)
-				if err != nil {
-					db.Close()
-					return nil, err
+				if _, err := db.Exec(schema.InsertSQL); err != nil {
+					return err
 				}
 			}
 		}
 	}
 
-	for _, item := range progression.SQLHistory {
-		if item.Query != "" && !f.isDangerousSQL(item.Query) {
-			_, err = db.Exec(item.Query)
-			if err != nil {
-				log.Printf("Aviso: Falha ao reexecutar query do histórico: %v", err)
+	image, err := serializeImage(db)
+	if err != nil {
+		log.Printf("Aviso: Falha ao serializar imagem base: %v", err)
+		return nil
+	}
+
+	f.Snapshots.Put(key, &Snapshot{
+		CaseID:  caso.ID,
+		Version: caso.Version,
+		Puzzle:  puzzle,
+		Image:   image,
+	})
+	return nil
+}
+
+// replayHistory reaplica o histórico a partir de from sem as restrições de
+// tabela do puzzle atual; índices e views só chegam ao histórico se o puzzle
+// da época permitia. Cada item recebe a mesma semente de random() da
+// execução original. Falhas não interrompem a reexecução, mas marcam a
+// divergência.
+//
+// Calcular o checksum custa uma leitura do banco inteiro, então o estado só
+// é conferido nos pontos de verificação (veja checksumPoints). Uma diferença
+// aponta para o primeiro comando depois do último ponto conferido.
+func (f *SQLiteFactory) replayHistory(sb *Sandbox, caso *models.Case, progression *models.Progression, history []models.SQLHistoryItem, from int) {
+	sb.Policy.Restrict(PolicyRestrictions{AllowIndexes: true, AllowViews: true})
+	defer sb.Policy.Restrict(PolicyRestrictions{})
+
+	// a divergência já registrada vale até o reparo; não há o que conferir
+	verify := !progression.Diverged
+	points := checksumPoints(progression, len(history))
+	verified := from - 1
+
+	seed := progression.RandomSeed()
+	for i := from; i < len(history); i++ {
+		item := history[i]
+		query := replayQuery(item)
+		if query == "" {
+			continue
+		}
+		sb.SeedStatement(seed, i)
+		if _, err := f.execWithTimeout(sb.DB, query); err != nil {
+			if denial := sb.Policy.TakeDenial(); denial != nil {
+				log.Printf("Aviso: Query do histórico bloqueada pela política do sandbox (%s %s)", denial.Action, denial.Target)
+				sb.markDivergence(i, item, "O comando passou a ser bloqueado pelas regras do caso.")
+				continue
 			}
+			log.Printf("Aviso: Falha ao reexecutar query do histórico: %v", err)
+			sb.markDivergence(i, item, fmt.Sprintf("O comando falhou ao ser reexecutado: %v", err))
+			continue
+		}
+
+		if !verify || !points[i] || item.Checksum == "" || sb.divergence != nil {
+			continue
+		}
+		sum, err := f.stateChecksum(sb, caso, item.PuzzleState)
+		if err != nil {
+			log.Printf("Aviso: Falha ao calcular checksum do histórico: %v", err)
+			continue
+		}
+		if sum != item.Checksum {
+			first := verified + 1
+			reason := "O banco reconstruído não confere com o estado registrado após o comando."
+			if first < i {
+				reason = fmt.Sprintf("O banco reconstruído não confere com o estado registrado entre os comandos %d e %d.", first+1, i+1)
+			}
+			sb.markDivergence(first, history[first], reason)
+			continue
+		}
+		verified = i
+	}
+}
+
+// checksumPoints marca os itens conferidos na reexecução: o último do
+// histórico e o último antes de cada checkpoint de puzzle, que são os
+// estados para onde um reparo pode voltar.
+func checksumPoints(progression *models.Progression, length int) map[int]bool {
+	points := map[int]bool{}
+	if length > 0 {
+		points[length-1] = true
+	}
+	for _, checkpoint := range progression.PuzzleCheckpoints {
+		if checkpoint > 0 && checkpoint <= length {
+			points[checkpoint-1] = true
 		}
 	}
+	return points
+}
 
-	return db, nil
+func (f *SQLiteFactory) stateChecksum(sb *Sandbox, caso *models.Case, puzzle int) (string, error) {
+	ctx, cancel := f.CommandContext()
+	defer cancel()
+	return sb.StateChecksum(ctx, caso, puzzle)
 }
 
-func (f *SQLiteFactory) isDangerousSQL(query string) bool {
-	upperQuery := strings.ToUpper(query)
-	dangerousKeywords := []string{"DROP", "TRUNCATE", "ALTER", "ATTACH", "DETACH", "VACUUM"}
+func (f *SQLiteFactory) execWithTimeout(db *sql.DB, query string) (sql.Result, error) {
+	ctx, cancel := f.CommandContext()
+	defer cancel()
+	return db.ExecContext(ctx, query)
+}
 
-	for _, keyword := range dangerousKeywords {
-		if strings.Contains(upperQuery, keyword) {
-			return true
-		}
+func (f *SQLiteFactory) CommandContext() (context.Context, context.CancelFunc) {
+	if f.Limits.QueryTimeout <= 0 {
+		return context.WithCancel(context.Background())
 	}
-	return false
+	return context.WithTimeout(context.Background(), f.Limits.QueryTimeout)
 }
 
-func (f *SQLiteFactory) ValidateSQL(query string) bool {
-	upperQuery := strings.ToUpper(query)
+func replayQuery(item models.SQLHistoryItem) string {
+	if item.Normalized != "" {
+		return item.Normalized
+	}
+	return item.Query
+}
 
-	if f.isDangerousSQL(query) {
-		return false
+// baseSnapshotKey inclui o relógio gravado no schema: progressões com
+// instantes diferentes não compartilham a imagem base.
+func baseSnapshotKey(caso *models.Case, puzzle int) string {
+	return fmt.Sprintf("base:%s:%d:%d:%s", caso.ID, caso.Version, puzzle, caso.SandboxClock)
+}
+
+func progressionSnapshotKey(progression *models.Progression) string {
+	return fmt.Sprintf("prog:%s:%s", progression.UserID.Hex(), progression.CaseID)
+}
+
+func withRawConn(db *sql.DB, fn func(conn *sqlite3.SQLiteConn) error) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
 	}
+	defer conn.Close()
 
-	allowedTables := []string{"pistas_logicas", "suspeitos", "livros", "funcionarios"}
-	for _, table := range allowedTables {
-		if strings.Contains(upperQuery, table) {
-			return true
+	return conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("conexão inesperada: %T", driverConn)
 		}
+		return fn(sqliteConn)
+	})
+}
+
+func serializeImage(db *sql.DB) ([]byte, error) {
+	var image []byte
+	err := withRawConn(db, func(conn *sqlite3.SQLiteConn) error {
+		var err error
+		image, err = conn.Serialize("main")
+		return err
+	})
+	return image, err
+}
+
+// restoreImage carrega a imagem em uma conexão auxiliar e a copia com a API
+// de backup: um banco aberto direto por sqlite3_deserialize não pode crescer.
+func restoreImage(db *sql.DB, image []byte) error {
+	srcConn, err := (&sqlite3.SQLiteDriver{}).Open(":memory:")
+	if err != nil {
+		return err
+	}
+	src := srcConn.(*sqlite3.SQLiteConn)
+	defer src.Close()
+
+	if err := src.Deserialize(image, "main"); err != nil {
+		return err
 	}
 
-	return strings.HasPrefix(upperQuery, "SELECT") ||
-		strings.HasPrefix(upperQuery, "INSERT") ||
-		strings.HasPrefix(upperQuery, "UPDATE") ||
-		strings.HasPrefix(upperQuery, "DELETE")
+	return withRawConn(db, func(dest *sqlite3.SQLiteConn) error {
+		backup, err := dest.Backup("main", src, "main")
+		if err != nil {
+			return err
+		}
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return err
+		}
+		return backup.Finish()
+	})
 }
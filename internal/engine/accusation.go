@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseAccusation separa "ACUSAR <suspeito> [COM <evidência>...]"; o nome do
+// suspeito pode ter espaços e as evidências vêm separadas por espaço,
+// vírgula ou E.
+func parseAccusation(args []string) (string, []string) {
+	suspect := make([]string, 0, len(args))
+	evidence := make([]string, 0)
+
+	inEvidence := false
+	for _, arg := range args {
+		if !inEvidence && strings.EqualFold(arg, "COM") {
+			inEvidence = true
+			continue
+		}
+		if !inEvidence {
+			suspect = append(suspect, arg)
+			continue
+		}
+		for _, piece := range strings.Split(arg, ",") {
+			piece = strings.ToLower(strings.TrimSpace(piece))
+			if piece == "" || piece == "e" || containsFold(evidence, piece) {
+				continue
+			}
+			evidence = append(evidence, piece)
+		}
+	}
+
+	return strings.ToLower(strings.Join(suspect, " ")), evidence
+}
+
+var defaultOutcomeNarratives = map[string]string{
+	models.OutcomeGood:    "As provas se encaixam. O culpado é levado algemado e o caso está encerrado.",
+	models.OutcomePartial: "Você acertou o culpado, mas as provas são frágeis. O caso é encerrado sob desconfiança.",
+	models.OutcomeWrong:   "A acusação desmorona. O verdadeiro culpado segue livre e o caso é arquivado.",
+}
+
+func maxAccusations(acc *models.Accusation) int {
+	if acc.MaxAttempts <= 0 {
+		return 1
+	}
+	return acc.MaxAttempts
+}
+
+// judgeAccusation compara suspeito e evidências com a solução do caso.
+func judgeAccusation(acc *models.Accusation, suspect string, evidence []string) string {
+	if !strings.EqualFold(suspect, acc.Culprit) {
+		return models.OutcomeWrong
+	}
+
+	correct := 0
+	for _, e := range evidence {
+		if containsFold(acc.Evidence, e) {
+			correct++
+		}
+	}
+
+	needed := acc.MinEvidence
+	if needed <= 0 || needed > len(acc.Evidence) {
+		needed = len(acc.Evidence)
+	}
+	if correct >= needed {
+		return models.OutcomeGood
+	}
+	return models.OutcomePartial
+}
+
+func (p *GameProcessor) handleAccusation(caso *models.Case, prog *models.Progression, args []string) *models.GameResponse {
+	accusationError := func(message string) *models.GameResponse {
+		return &models.GameResponse{
+			Success:   false,
+			Error:     message,
+			ErrorCode: models.ErrAccusationInvalid,
+			State:     p.getCurrentState(caso, prog),
+		}
+	}
+
+	acc := caso.Accusation
+	if acc == nil {
+		return accusationError("Não há a quem acusar formalmente nesta investigação.")
+	}
+	if prog.Outcome != "" {
+		return accusationError("O caso já foi encerrado. Não há mais acusações a fazer.")
+	}
+	if !acc.Available(progressionState{prog}) {
+		message := acc.LockedMessage
+		if message == "" {
+			message = "Ainda é cedo para uma acusação formal. Reúna mais provas."
+		}
+		return accusationError(message)
+	}
+
+	suspect, evidence := parseAccusation(args)
+	if suspect == "" {
+		return accusationError("Use ACUSAR <suspeito> [COM <evidência>...].")
+	}
+	if len(acc.Suspects) > 0 && !containsFold(acc.Suspects, suspect) {
+		return accusationError(fmt.Sprintf("Não há suspeito chamado %q nesta investigação.", strings.ToUpper(suspect)))
+	}
+	if acc.EvidenceFromInventory {
+		for _, e := range evidence {
+			if !containsFold(prog.Inventory, e) {
+				return accusationError(fmt.Sprintf("Você não tem %s consigo para apresentar como evidência.", itemName(caso, e)))
+			}
+		}
+	}
+
+	outcome := judgeAccusation(acc, suspect, evidence)
+	prog.Accusations = append(prog.Accusations, models.AccusationAttempt{
+		Timestamp: time.Now(),
+		Suspect:   suspect,
+		Evidence:  evidence,
+		Outcome:   outcome,
+	})
+
+	attemptsLeft := maxAccusations(acc) - len(prog.Accusations)
+	if outcome != models.OutcomeGood && attemptsLeft > 0 {
+		narrative := acc.RetryNarrative
+		if narrative == "" {
+			narrative = "O delegado ouve sua acusação, cruza os braços e balança a cabeça. As provas não sustentam essa versão."
+		}
+		return &models.GameResponse{
+			Success:    true,
+			Narrative:  fmt.Sprintf("%s (Restam %d tentativa(s).)", narrative, attemptsLeft),
+			Accusation: &models.AccusationResult{AttemptsLeft: attemptsLeft},
+			State:      p.getCurrentState(caso, prog),
+		}
+	}
+
+	endingID := acc.WrongEnding
+	switch outcome {
+	case models.OutcomeGood:
+		endingID = acc.GoodEnding
+	case models.OutcomePartial:
+		endingID = acc.PartialEnding
+	}
+	narrative := defaultOutcomeNarratives[outcome]
+	imageKey := ""
+	var ending *models.Ending
+	if endingID != "" {
+		ending = findEnding(caso, endingID)
+		if ending.Narrative != "" {
+			narrative = ending.Narrative
+		}
+		imageKey = ending.ImageKey
+		prog.Ending = ending.ID
+	}
+
+	prog.Outcome = outcome
+	completeCase(prog)
+
+	return &models.GameResponse{
+		Success:         true,
+		Narrative:       narrative,
+		SuccessImageKey: imageKey,
+		Ending:          ending,
+		Accusation: &models.AccusationResult{
+			Final:        true,
+			Outcome:      outcome,
+			AttemptsLeft: max(attemptsLeft, 0),
+		},
+		State: p.getCurrentState(caso, prog),
+	}
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"strings"
+)
+
+// progressionState expõe a progressão às condições compiladas do caso.
+type progressionState struct {
+	prog *models.Progression
+}
+
+func (s progressionState) Puzzle() int {
+	return s.prog.CurrentPuzzle
+}
+
+func (s progressionState) Focus() string {
+	return s.prog.CurrentFocus
+}
+
+func (s progressionState) InFocus(object string) bool {
+	return s.prog.InFocus(object)
+}
+
+func (s progressionState) Flag(name string) bool {
+	return s.prog.Flags[strings.ToLower(name)]
+}
+
+func (s progressionState) Visited(name string) bool {
+	return containsFold(s.prog.Visited, name)
+}
+
+func (s progressionState) Counter(name string) int {
+	return s.prog.Counters[strings.ToLower(name)]
+}
+
+func (s progressionState) HasItem(name string) bool {
+	return containsFold(s.prog.Inventory, name)
+}
+
+func (s progressionState) Solved(puzzle int) bool {
+	return isSolved(s.prog, puzzle)
+}
+
+func containsFold(values []string, target string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// markVisited registra o objeto examinado para condições com visited.
+func markVisited(prog *models.Progression, object string) {
+	if object == "" || object == "none" || (progressionState{prog}).Visited(object) {
+		return
+	}
+	prog.Visited = append(prog.Visited, strings.ToLower(object))
+}
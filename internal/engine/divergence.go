@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"strings"
+)
+
+// openSandbox reconstrói o banco da progressão e, se a reexecução do
+// histórico divergir do que o jogador viu, marca a progressão. A primeira
+// divergência registrada é mantida até um reparo.
+func (p *GameProcessor) openSandbox(caso *models.Case, progression *models.Progression) (*db.Sandbox, error) {
+	dbInstance, err := p.SQLiteFactory.CreateInMemoryDB(p.sandboxCase(caso, progression), progression)
+	if err != nil {
+		return nil, err
+	}
+
+	if d := dbInstance.Divergence(); d != nil && !progression.Diverged {
+		progression.Diverged = true
+		progression.Divergence = d
+	}
+	return dbInstance, nil
+}
+
+// RepairOptions lista os modos de reparo possíveis para a divergência atual.
+// Voltar ao checkpoint só resolve se a divergência veio depois dele, e só é
+// oferecido se não descartar comandos de outros puzzles.
+func (p *GameProcessor) RepairOptions(progression *models.Progression) []string {
+	if !progression.Diverged || progression.Divergence == nil {
+		return nil
+	}
+
+	options := []string{models.RepairLastGood}
+	checkpoint := p.getPuzzleCheckpoint(progression, progression.CurrentPuzzle)
+	if checkpoint >= 0 && checkpoint <= progression.Divergence.Index && checkpoint <= len(progression.SQLHistory) && !otherPuzzleAfter(progression, checkpoint) {
+		options = append(options, models.RepairPuzzleCheckpoint)
+	}
+	return options
+}
+
+// RepairProgression descarta a parte do histórico que deixou de ser
+// reproduzível: em last_good ficam os comandos anteriores à divergência, em
+// puzzle_checkpoint o puzzle atual recomeça do seu checkpoint. A transação
+// pendente é sempre descartada. A gravação fica com o handler, que usa o
+// resumo em Repair.
+func (p *GameProcessor) RepairProgression(caso *models.Case, progression *models.Progression, mode string) (*models.GameResponse, error) {
+	repairError := func(message string) *models.GameResponse {
+		return &models.GameResponse{
+			Success:   false,
+			Error:     message,
+			ErrorCode: models.ErrRepairUnavailable,
+			State:     p.getCurrentState(caso, progression),
+		}
+	}
+
+	if !progression.Diverged || progression.Divergence == nil {
+		return repairError("O histórico desta investigação está íntegro; não há nada para reparar."), nil
+	}
+
+	available := p.RepairOptions(progression)
+	if !containsString(available, mode) {
+		return repairError(fmt.Sprintf("Modo de reparo indisponível. Opções: %s.", strings.Join(available, ", "))), nil
+	}
+
+	keep := progression.Divergence.Index
+	if keep > len(progression.SQLHistory) {
+		keep = len(progression.SQLHistory)
+	}
+	if mode == models.RepairPuzzleCheckpoint {
+		keep = p.getPuzzleCheckpoint(progression, progression.CurrentPuzzle)
+	}
+
+	repaired := *progression
+	repaired.SQLHistory = progression.SQLHistory[:keep:keep]
+	repaired.PendingSQL = nil
+	repaired.InTransaction = false
+	repaired.Diverged = false
+	repaired.Divergence = nil
+	repaired.PuzzleCheckpoints = make(map[string]int, len(progression.PuzzleCheckpoints))
+	for puzzle, idx := range progression.PuzzleCheckpoints {
+		repaired.PuzzleCheckpoints[puzzle] = min(idx, keep)
+	}
+	if mode == models.RepairPuzzleCheckpoint {
+		repaired.ClearFocus()
+		p.restoreStoryCheckpoint(&repaired)
+	}
+
+	// reconstrói o banco já reparado para confirmar que ele é reproduzível
+	// e deixar o snapshot pronto para o próximo comando
+	dbInstance, err := p.SQLiteFactory.CreateInMemoryDB(p.sandboxCase(caso, progression), &repaired)
+	if err != nil {
+		return nil, err
+	}
+	defer dbInstance.Close()
+
+	if d := dbInstance.Divergence(); d != nil {
+		return repairError(fmt.Sprintf("O histórico mantido ainda diverge no comando %d. Tente outro modo de reparo.", d.Index+1)), nil
+	}
+
+	removed := make([]string, 0, len(progression.EffectiveHistory())-keep)
+	for _, item := range progression.EffectiveHistory()[keep:] {
+		removed = append(removed, item.Query)
+	}
+
+	*progression = repaired
+
+	narrative := fmt.Sprintf("Histórico reparado: %d comando(s) descartado(s). O banco foi reconstruído até o último estado consistente.", len(removed))
+	if mode == models.RepairPuzzleCheckpoint {
+		narrative = fmt.Sprintf("Histórico reparado: %d comando(s) descartado(s). Você volta ao início do puzzle atual.", len(removed))
+	}
+
+	return &models.GameResponse{
+		Success:   true,
+		Narrative: narrative,
+		Repair: &models.RepairSummary{
+			Mode:       mode,
+			Kept:       keep,
+			Removed:    len(removed),
+			Statements: removed,
+		},
+		State: p.getCurrentState(caso, progression),
+	}, nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
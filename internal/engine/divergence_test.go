@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"testing"
+	"time"
+)
+
+// clockCase não declara world_time e usa o relógio no schema e nos comandos.
+func clockCase() *models.Case {
+	caso := testCase()
+	caso.Schemas = append(caso.Schemas, models.Schema{
+		Puzzle:    1,
+		TableName: "registros",
+		CreateSQL: "CREATE TABLE registros (id INTEGER PRIMARY KEY, nota TEXT, em TEXT DEFAULT CURRENT_TIMESTAMP, dia TEXT DEFAULT (date('now')))",
+	})
+	caso.Puzzles[0].Tables = append(caso.Puzzles[0].Tables, "registros")
+	return caso
+}
+
+func TestReplayIsDeterministic(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+	}{
+		{"DEFAULT do schema", []string{"INSERT INTO registros (nota) VALUES ('a')"}},
+		{"CURRENT_TIMESTAMP no comando", []string{"INSERT INTO registros (nota, em) VALUES ('b', CURRENT_TIMESTAMP)"}},
+		{"strftime sem data", []string{"UPDATE suspeitos SET cargo = strftime('%H:%M:%S') WHERE id = 1"}},
+		{"random", []string{"UPDATE suspeitos SET cargo = random() WHERE id = 2"}},
+		{
+			"vários comandos",
+			[]string{
+				"INSERT INTO registros (nota) VALUES ('c')",
+				"UPDATE registros SET nota = datetime('now', 'localtime')",
+				"DELETE FROM suspeitos WHERE id = 3",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGame(t, clockCase())
+			for _, command := range tt.commands {
+				g.mustRun(command)
+			}
+
+			// o banco é reconstruído do zero, um segundo depois
+			time.Sleep(1100 * time.Millisecond)
+			g.restart()
+			g.mustRun("SELECT * FROM registros")
+
+			if g.prog.Diverged {
+				t.Fatalf("progressão marcada como divergente: %s", g.prog.Divergence.Reason)
+			}
+		})
+	}
+}
+
+func TestUndoRebuildIsDeterministic(t *testing.T) {
+	g := newTestGame(t, clockCase())
+	g.mustRun("INSERT INTO registros (nota) VALUES ('a')")
+	g.mustRun("INSERT INTO registros (nota) VALUES ('b')")
+
+	time.Sleep(1100 * time.Millisecond)
+	// desfazer descarta o snapshot e obriga a reexecutar o histórico
+	g.mustRun("DESFAZER")
+	g.mustRun("SELECT * FROM registros")
+
+	if g.prog.Diverged {
+		t.Fatalf("progressão marcada como divergente: %s", g.prog.Divergence.Reason)
+	}
+}
+
+func TestReplayDetectsChangedCase(t *testing.T) {
+	g := newTestGame(t, testCase())
+	g.mustRun("UPDATE suspeitos SET cargo = 'X' WHERE nome = 'Ana'")
+	g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'")
+	g.mustRun("INSERT INTO pistas (suspeito_id, descricao) VALUES (3, 'luva')")
+
+	// o autor muda os dados do puzzle 1 numa versão nova do caso
+	g.caso.Version = 2
+	g.caso.Schemas[0].InsertSQL = "INSERT INTO suspeitos (nome, cargo) VALUES ('Ana', 'Analista'), ('Bruno', 'Chefe'), ('Carla', 'Diretora')"
+	g.mustRun("SELECT COUNT(*) FROM pistas")
+
+	if !g.prog.Diverged || g.prog.Divergence == nil {
+		t.Fatal("a mudança no caso deveria marcar a divergência")
+	}
+	if g.prog.Divergence.Index != 0 {
+		t.Errorf("divergência no item %d, quer 0", g.prog.Divergence.Index)
+	}
+
+	want := []string{models.RepairLastGood}
+	if got := g.p.RepairOptions(g.prog); len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("RepairOptions = %v, quer %v", got, want)
+	}
+
+	resp, err := g.p.RepairProgression(g.caso, g.prog, models.RepairLastGood)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Repair.Removed != 3 {
+		t.Fatalf("reparo: %+v", resp)
+	}
+
+	g.restart()
+	g.mustRun("SELECT * FROM suspeitos")
+	if g.prog.Diverged {
+		t.Error("progressão reparada continua divergente")
+	}
+}
@@ -0,0 +1,418 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxDiffTableRows limita o tamanho das tabelas copiadas para o diff; tabelas
+// maiores ficam de fora e a resposta é marcada como truncada.
+const maxDiffTableRows = 10000
+
+type tableImage struct {
+	columns []string
+	rows    map[int64][]interface{}
+}
+
+// captureTables copia as linhas das tabelas tocadas pelo comando, indexadas
+// pelo rowid. Views, tabelas WITHOUT ROWID e tabelas grandes demais são
+// ignoradas (nil no mapa).
+func captureTables(ctx context.Context, sb *db.Sandbox, tables []string) map[string]*tableImage {
+	images := make(map[string]*tableImage, len(tables))
+
+	_ = sb.Trusted(func() error {
+		for _, table := range tables {
+			images[table] = captureTable(ctx, sb, table)
+		}
+		return nil
+	})
+
+	return images
+}
+
+func captureTable(ctx context.Context, sb *db.Sandbox, table string) *tableImage {
+	rows, err := sb.QueryContext(ctx, fmt.Sprintf(`SELECT rowid AS "__rowid__", * FROM %s`, quoteIdent(table)))
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	image, more := readImage(rows, maxDiffTableRows)
+	if more {
+		return nil
+	}
+	return image
+}
+
+// readImage lê até limit linhas de uma consulta cuja primeira coluna é o
+// rowid; more indica que havia mais linhas.
+func readImage(rows *sql.Rows, limit int) (image *tableImage, more bool) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, false
+	}
+
+	image = &tableImage{columns: cols[1:], rows: map[int64][]interface{}{}}
+	for rows.Next() {
+		if len(image.rows) >= limit {
+			return image, true
+		}
+
+		var rowid int64
+		values := make([]interface{}, len(cols)-1)
+		pointers := make([]interface{}, len(cols))
+		pointers[0] = &rowid
+		for i := range values {
+			pointers[i+1] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, false
+		}
+
+		for i, v := range values {
+			values[i] = renderCell(v)
+		}
+		image.rows[rowid] = values
+	}
+	if rows.Err() != nil {
+		return nil, false
+	}
+
+	return image, false
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// dmlDiff acompanha um INSERT, UPDATE ou DELETE do jogador. Quando o comando
+// tem a forma simples de dmlScope, só as linhas que ele pode tocar são lidas:
+// as que casam com o WHERE antes do comando e, depois, as mesmas pelo rowid
+// (ou as novas, acima do maior rowid, no INSERT). Nos outros casos as tabelas
+// envolvidas são copiadas inteiras, como antes.
+type dmlDiff struct {
+	tables    []string
+	scope     *dmlScope
+	before    map[string]*tableImage
+	lastRowid int64
+	truncated bool
+}
+
+func (p *GameProcessor) beginDiff(ctx context.Context, sb *db.Sandbox, stmt SQLStatement, query string) *dmlDiff {
+	if scope, ok := scopeDML(query); ok {
+		if d, ok := p.scopedBefore(ctx, sb, scope); ok {
+			return d
+		}
+	}
+	return &dmlDiff{tables: stmt.Tables, before: captureTables(ctx, sb, stmt.Tables)}
+}
+
+func (p *GameProcessor) diffRowLimit() int {
+	if limit := p.SQLiteFactory.Limits.MaxRows; limit > 0 {
+		return limit
+	}
+	return maxDiffTableRows
+}
+
+func (p *GameProcessor) scopedBefore(ctx context.Context, sb *db.Sandbox, scope dmlScope) (*dmlDiff, bool) {
+	d := &dmlDiff{tables: []string{scope.table}, scope: &scope}
+
+	if scope.kind == StmtInsert {
+		err := sb.Trusted(func() error {
+			return sb.QueryRowContext(ctx, "SELECT COALESCE(MAX(rowid), 0) FROM "+quoteIdent(scope.table)).Scan(&d.lastRowid)
+		})
+		if err != nil {
+			return nil, false
+		}
+		d.before = map[string]*tableImage{scope.table: {rows: map[int64][]interface{}{}}}
+		return d, true
+	}
+
+	// o WHERE é do jogador: roda com a política do puzzle, como o comando
+	query := `SELECT rowid AS "__rowid__", * FROM ` + scope.source
+	if scope.where != "" {
+		query += " WHERE " + scope.where
+	}
+	query += fmt.Sprintf(" LIMIT %d", p.diffRowLimit()+1)
+
+	rows, err := sb.QueryContext(ctx, query)
+	if err != nil {
+		sb.Policy.TakeDenial()
+		return nil, false
+	}
+	defer rows.Close()
+
+	image, more := readImage(rows, p.diffRowLimit())
+	if image == nil {
+		return nil, false
+	}
+	d.before = map[string]*tableImage{scope.table: image}
+	d.truncated = more
+	return d, true
+}
+
+func (p *GameProcessor) finishDiff(ctx context.Context, sb *db.Sandbox, d *dmlDiff, affected int64) *models.DMLChanges {
+	if d.scope == nil {
+		after := captureTables(ctx, sb, d.tables)
+		return p.diffTables(d.tables, d.before, after, affected)
+	}
+
+	table := d.scope.table
+	before := d.before[table]
+	var query string
+	switch {
+	case d.scope.kind == StmtInsert:
+		query = fmt.Sprintf(`SELECT rowid AS "__rowid__", * FROM %s WHERE rowid > %d ORDER BY rowid LIMIT %d`, quoteIdent(table), d.lastRowid, p.diffRowLimit()+1)
+	case len(before.rows) == 0:
+		query = fmt.Sprintf(`SELECT rowid AS "__rowid__", * FROM %s LIMIT 0`, quoteIdent(table))
+	default:
+		ids := make([]string, 0, len(before.rows))
+		for id := range before.rows {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+		query = fmt.Sprintf(`SELECT rowid AS "__rowid__", * FROM %s WHERE rowid IN (%s)`, quoteIdent(table), strings.Join(ids, ", "))
+	}
+
+	var after *tableImage
+	truncated := d.truncated
+	_ = sb.Trusted(func() error {
+		rows, err := sb.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		var more bool
+		after, more = readImage(rows, p.diffRowLimit())
+		truncated = truncated || more
+		return nil
+	})
+
+	changes := p.diffTables(d.tables, d.before, map[string]*tableImage{table: after}, affected)
+	// changes() conta as linhas do comando; se o recorte não viu todas,
+	// a lista está incompleta
+	seen := len(before.rows)
+	if after != nil && d.scope.kind == StmtInsert {
+		seen = len(after.rows)
+	}
+	if truncated || int64(seen) != affected {
+		changes.Truncated = true
+	}
+	return changes
+}
+
+// dmlScope descreve o alvo de um INSERT, UPDATE ou DELETE simples.
+type dmlScope struct {
+	kind   StatementKind
+	table  string // tabela alterada, como em SQLStatement.Tables
+	source string // alvo como escrito no comando, com schema e alias
+	where  string // condição do WHERE; vazia quando não há
+}
+
+// scopeDML recorta o alvo e o WHERE do comando. WITH, UPDATE ... FROM,
+// ORDER BY/LIMIT, REPLACE, upsert e random() ficam de fora: o recorte não
+// acharia as mesmas linhas ou consumiria a sequência de random() do comando.
+func scopeDML(query string) (dmlScope, bool) {
+	tokens := tokenizeSQL(query)
+	if len(tokens) < 2 {
+		return dmlScope{}, false
+	}
+
+	depth := 0
+	for i, tok := range tokens {
+		call := i+1 < len(tokens) && tokens[i+1].isSymbol("(")
+		switch {
+		case tok.isSymbol("("):
+			depth++
+		case tok.isSymbol(")"):
+			depth--
+		case call && tok.isWord("RANDOM", "RANDOMBLOB"):
+			return dmlScope{}, false
+		case !call && tok.isWord("REPLACE"):
+			return dmlScope{}, false
+		case depth == 0 && tok.isWord("ORDER", "LIMIT"):
+			return dmlScope{}, false
+		case tok.isWord("DO") && i+1 < len(tokens) && tokens[i+1].isWord("UPDATE"):
+			return dmlScope{}, false
+		}
+	}
+
+	scope := dmlScope{}
+	var start, end int
+	switch {
+	case tokens[0].isWord("INSERT"):
+		into := topLevelWord(tokens, 1, "INTO")
+		if into < 0 || into+1 >= len(tokens) {
+			return dmlScope{}, false
+		}
+		scope.kind = StmtInsert
+		scope.table = targetName(tokens, into+1)
+		return scope, scope.table != ""
+
+	case tokens[0].isWord("UPDATE"):
+		scope.kind = StmtUpdate
+		start = 1
+		if tokens[1].isWord("OR") {
+			start = 3
+		}
+		end = topLevelWord(tokens, start, "SET")
+		if end <= start || topLevelWord(tokens, end, "FROM") >= 0 {
+			return dmlScope{}, false
+		}
+
+	case tokens[0].isWord("DELETE") && tokens[1].isWord("FROM"):
+		scope.kind = StmtDelete
+		start = 2
+		end = len(tokens)
+		for _, word := range []string{"WHERE", "RETURNING"} {
+			if i := topLevelWord(tokens, start, word); i >= 0 && i < end {
+				end = i
+			}
+		}
+		if end <= start {
+			return dmlScope{}, false
+		}
+
+	default:
+		return dmlScope{}, false
+	}
+
+	scope.table = targetName(tokens, start)
+	scope.source = query[tokens[start].Start:tokens[end-1].End]
+
+	if where := topLevelWord(tokens, start, "WHERE"); where >= 0 && where+1 < len(tokens) {
+		stop := len(query)
+		if returning := topLevelWord(tokens, where, "RETURNING"); returning >= 0 {
+			stop = tokens[returning].Start
+		}
+		scope.where = strings.TrimRight(strings.TrimSpace(query[tokens[where+1].Start:stop]), ";")
+	}
+
+	return scope, scope.table != ""
+}
+
+// topLevelWord procura word fora de parênteses a partir de from.
+func topLevelWord(tokens []sqlToken, from int, word string) int {
+	depth := 0
+	for i := from; i < len(tokens); i++ {
+		switch {
+		case tokens[i].isSymbol("("):
+			depth++
+		case tokens[i].isSymbol(")"):
+			depth--
+		case depth == 0 && tokens[i].isWord(word):
+			return i
+		}
+	}
+	return -1
+}
+
+// targetName lê o nome da tabela em tokens[i], pulando o schema.
+func targetName(tokens []sqlToken, i int) string {
+	if i+2 < len(tokens) && tokens[i].isName() && tokens[i+1].isSymbol(".") && tokens[i+2].isName() {
+		return tokens[i+2].name()
+	}
+	if i < len(tokens) && tokens[i].isName() {
+		return tokens[i].name()
+	}
+	return ""
+}
+
+func (p *GameProcessor) diffTables(tables []string, before, after map[string]*tableImage, affected int64) *models.DMLChanges {
+	limits := p.SQLiteFactory.Limits
+	changes := &models.DMLChanges{RowsAffected: affected, Tables: make([]models.TableChanges, 0)}
+	listed := 0
+
+	cell := func(row []interface{}) []interface{} {
+		out := make([]interface{}, len(row))
+		for i, v := range row {
+			var cut bool
+			out[i], cut = truncateCell(v, limits.MaxCellBytes)
+			if cut {
+				changes.Truncated = true
+			}
+		}
+		return out
+	}
+
+	full := func() bool {
+		if limits.MaxRows > 0 && listed >= limits.MaxRows {
+			changes.Truncated = true
+			return true
+		}
+		listed++
+		return false
+	}
+
+	for _, table := range tables {
+		old, cur := before[table], after[table]
+		if old == nil || cur == nil {
+			if old != nil || cur != nil {
+				changes.Truncated = true
+			}
+			continue
+		}
+
+		tc := models.TableChanges{Table: table, Columns: cur.columns}
+
+		for _, rowid := range sortedRowIDs(old.rows, cur.rows) {
+			prev, hadPrev := old.rows[rowid]
+			next, hasNext := cur.rows[rowid]
+
+			switch {
+			case hadPrev && !hasNext:
+				if !full() {
+					tc.Deleted = append(tc.Deleted, cell(prev))
+				}
+			case !hadPrev && hasNext:
+				if !full() {
+					tc.Inserted = append(tc.Inserted, cell(next))
+				}
+			default:
+				changed := changedColumns(cur.columns, prev, next)
+				if len(changed) > 0 && !full() {
+					tc.Updated = append(tc.Updated, models.RowChange{
+						Before:         cell(prev),
+						After:          cell(next),
+						ChangedColumns: changed,
+					})
+				}
+			}
+		}
+
+		if len(tc.Inserted)+len(tc.Deleted)+len(tc.Updated) > 0 {
+			changes.Tables = append(changes.Tables, tc)
+		}
+	}
+
+	return changes
+}
+
+func sortedRowIDs(before, after map[int64][]interface{}) []int64 {
+	ids := make([]int64, 0, len(after))
+	for id := range before {
+		ids = append(ids, id)
+	}
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func changedColumns(columns []string, before, after []interface{}) []string {
+	changed := make([]string, 0)
+	for i, col := range columns {
+		if i >= len(before) || i >= len(after) || before[i] != after[i] {
+			changed = append(changed, col)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestScopeDML(t *testing.T) {
+	tests := []struct {
+		query string
+		ok    bool
+		want  dmlScope
+	}{
+		{"UPDATE suspeitos SET cargo = 'X' WHERE id = 1", true, dmlScope{StmtUpdate, "suspeitos", "suspeitos", "id = 1"}},
+		{"UPDATE OR IGNORE main.suspeitos AS s SET cargo = replace(cargo, 'a', 'b') WHERE s.id IN (SELECT 1) RETURNING id", true, dmlScope{StmtUpdate, "suspeitos", "main.suspeitos AS s", "s.id IN (SELECT 1)"}},
+		{"UPDATE suspeitos SET preso = 1", true, dmlScope{StmtUpdate, "suspeitos", "suspeitos", ""}},
+		{"DELETE FROM \"Pistas\" WHERE descricao LIKE '%a%';", true, dmlScope{StmtDelete, "Pistas", `"Pistas"`, "descricao LIKE '%a%'"}},
+		{"DELETE FROM pistas", true, dmlScope{StmtDelete, "pistas", "pistas", ""}},
+		{"INSERT INTO pistas (descricao) VALUES ('a')", true, dmlScope{kind: StmtInsert, table: "pistas"}},
+		{"INSERT OR IGNORE INTO main.pistas SELECT * FROM pistas", true, dmlScope{kind: StmtInsert, table: "pistas"}},
+
+		{"UPDATE suspeitos SET cargo = 'X' WHERE random() > 0", false, dmlScope{}},
+		{"INSERT INTO pistas (descricao) VALUES (randomblob(4))", false, dmlScope{}},
+		{"UPDATE suspeitos SET cargo = p.descricao FROM pistas p WHERE p.suspeito_id = suspeitos.id", false, dmlScope{}},
+		{"DELETE FROM pistas ORDER BY id LIMIT 1", false, dmlScope{}},
+		{"REPLACE INTO pistas (id, descricao) VALUES (1, 'a')", false, dmlScope{}},
+		{"INSERT OR REPLACE INTO pistas (id) VALUES (1)", false, dmlScope{}},
+		{"INSERT INTO pistas (id) VALUES (1) ON CONFLICT (id) DO UPDATE SET descricao = 'b'", false, dmlScope{}},
+		{"WITH x AS (SELECT 1) DELETE FROM pistas WHERE id IN x", false, dmlScope{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, ok := scopeDML(tt.query)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, quer %v (%+v)", ok, tt.ok, got)
+			}
+			if ok && got != tt.want {
+				t.Errorf("scopeDML = %+v, quer %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDMLChanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   string
+		affected  int64
+		inserted  int
+		deleted   int
+		updated   int
+		truncated bool
+	}{
+		{"update com WHERE", "UPDATE suspeitos SET cargo = 'Gerente' WHERE nome IN ('Ana', 'Carla')", 2, 0, 0, 2, false},
+		{"update sem mudança", "UPDATE suspeitos SET cargo = cargo WHERE id = 1", 1, 0, 0, 0, false},
+		{"update de tudo", "UPDATE suspeitos SET preso = 1", 3, 0, 0, 3, false},
+		{"delete", "DELETE FROM pistas WHERE descricao = 'CABELO'", 1, 0, 1, 0, false},
+		{"delete sem linhas", "DELETE FROM pistas WHERE id > 10", 0, 0, 0, 0, false},
+		{"insert", "INSERT INTO pistas (suspeito_id, descricao) VALUES (3, 'luva'), (3, 'faca')", 2, 2, 0, 0, false},
+		{"insert com rowid baixo", "INSERT INTO suspeitos (id, nome) VALUES (0, 'Davi')", 1, 0, 0, 0, true},
+		{"tabela inteira", "UPDATE suspeitos SET cargo = 'X' WHERE random() <> 0", 3, 0, 0, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caso := testCase()
+			caso.Puzzles[0].Tables = []string{"suspeitos", "pistas"}
+			caso.Schemas[1].Puzzle = 1
+			g := newTestGame(t, caso)
+
+			changes := g.mustRun(tt.command).Changes
+			if changes == nil {
+				t.Fatal("resposta sem changes")
+			}
+			var inserted, deleted, updated int
+			for _, tc := range changes.Tables {
+				inserted += len(tc.Inserted)
+				deleted += len(tc.Deleted)
+				updated += len(tc.Updated)
+			}
+			got := []interface{}{changes.RowsAffected, inserted, deleted, updated, changes.Truncated}
+			want := []interface{}{tt.affected, tt.inserted, tt.deleted, tt.updated, tt.truncated}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("afetadas, inseridas, apagadas, alteradas, truncado = %v, quer %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDMLChangesRowLimit(t *testing.T) {
+	g := newTestGame(t, testCase())
+	g.p.SQLiteFactory.Limits.MaxRows = 2
+
+	changes := g.mustRun("UPDATE suspeitos SET preso = 1").Changes
+	if !changes.Truncated || len(changes.Tables) != 1 || len(changes.Tables[0].Updated) != 2 {
+		t.Errorf("changes = %+v, quer 2 linhas e truncado", changes)
+	}
+	if changes.RowsAffected != 3 {
+		t.Errorf("RowsAffected = %d, quer 3", changes.RowsAffected)
+	}
+}
+
+func TestDMLDiffRespectsPolicy(t *testing.T) {
+	g := newTestGame(t, testCase())
+	resp := g.run("DELETE FROM suspeitos WHERE load_extension('x') IS NULL")
+	if resp.Success || resp.ErrorClass != models.ErrorClassPolicyDenied {
+		t.Fatalf("o WHERE com função bloqueada deveria ser negado: %s (%s)", resp.Error, resp.ErrorCode)
+	}
+	if got := g.column("SELECT COUNT(*) FROM suspeitos"); got[0] != int64(3) {
+		t.Errorf("%v suspeitos, quer 3", got[0])
+	}
+}
+
+// só o último item de um script guarda o checksum
+func TestChecksumOnlyOnLastItem(t *testing.T) {
+	g := newTestGame(t, testCase())
+	g.mustRun("UPDATE suspeitos SET cargo = 'A' WHERE id = 1; UPDATE suspeitos SET cargo = 'B' WHERE id = 2")
+	g.mustRun("UPDATE suspeitos SET cargo = 'C' WHERE id = 3")
+
+	var sums []bool
+	for _, item := range g.prog.SQLHistory {
+		sums = append(sums, item.Checksum != "")
+	}
+	if want := []bool{false, true, true}; !reflect.DeepEqual(sums, want) {
+		t.Errorf("itens com checksum = %v, quer %v", sums, want)
+	}
+
+	g.restart()
+	g.mustRun("SELECT * FROM suspeitos")
+	if g.prog.Diverged {
+		t.Errorf("progressão divergente: %s", g.prog.Divergence.Reason)
+	}
+}
+
+// o recorte lê só as linhas do WHERE, não a tabela inteira
+func TestBeginDiffReadsMatchedRows(t *testing.T) {
+	g := newTestGame(t, testCase())
+	sb, err := g.p.openSandbox(g.caso, g.prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	ctx, cancel := g.p.SQLiteFactory.CommandContext()
+	defer cancel()
+
+	query := "UPDATE suspeitos SET cargo = 'X' WHERE nome = 'Bruno'"
+	d := g.p.beginDiff(ctx, sb, ClassifySQL(query), query)
+	if d.scope == nil || len(d.before["suspeitos"].rows) != 1 {
+		t.Fatalf("diff = %+v, quer só a linha de Bruno", d)
+	}
+
+	query = "UPDATE suspeitos SET cargo = 'X' WHERE random() <> 0"
+	if d := g.p.beginDiff(ctx, sb, ClassifySQL(query), query); d.scope != nil || len(d.before["suspeitos"].rows) != 3 {
+		t.Errorf("com random() o diff deveria copiar a tabela: %+v", d)
+	}
+}
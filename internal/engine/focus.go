@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"strings"
+)
+
+func objectParent(caso *models.Case, object string) string {
+	for child, parent := range caso.Config.ObjectParents {
+		if strings.EqualFold(child, object) {
+			return strings.ToLower(parent)
+		}
+	}
+	return ""
+}
+
+// focusReachable diz se o objeto pode ser examinado agora: objetos sem pai
+// estão sempre ao alcance, os outros exigem o pai na pilha de foco.
+func focusReachable(caso *models.Case, prog *models.Progression, object string) bool {
+	parent := objectParent(caso, object)
+	return parent == "" || prog.InFocus(parent)
+}
+
+// lookAt põe o objeto no topo da pilha logo acima do seu pai; um objeto sem
+// pai recomeça a pilha.
+func lookAt(caso *models.Case, prog *models.Progression, object string) {
+	object = strings.ToLower(object)
+	parent := objectParent(caso, object)
+
+	path := make([]string, 0, len(prog.FocusPath())+1)
+	if parent != "" {
+		for _, f := range prog.FocusPath() {
+			path = append(path, f)
+			if strings.EqualFold(f, parent) {
+				break
+			}
+		}
+	}
+	prog.SetFocusPath(append(path, object))
+}
+
+// handleBack trata VOLTAR: sai do objeto atual e volta ao que o contém.
+func (p *GameProcessor) handleBack(caso *models.Case, prog *models.Progression) *models.GameResponse {
+	path := prog.FocusPath()
+	if len(path) == 0 {
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: "Você não está examinando nada no momento.",
+			State:     p.getCurrentState(caso, prog),
+		}
+	}
+
+	prog.SetFocusPath(append([]string(nil), path[:len(path)-1]...))
+
+	narrative := "Você se afasta e observa o ambiente."
+	if prog.CurrentFocus != "none" {
+		narrative = fmt.Sprintf("Você volta a examinar %s.", strings.ToUpper(prog.CurrentFocus))
+	}
+	return &models.GameResponse{
+		Success:   true,
+		Narrative: narrative,
+		State:     p.getCurrentState(caso, prog),
+	}
+}
+
+func (p *GameProcessor) unreachableResponse(caso *models.Case, prog *models.Progression, object string) *models.GameResponse {
+	return &models.GameResponse{
+		Success:    false,
+		Error:      fmt.Sprintf("Daqui você não alcança %s. Examine %s primeiro.", strings.ToUpper(object), strings.ToUpper(objectParent(caso, object))),
+		ErrorCode:  models.ErrFocusRequired,
+		ErrorClass: models.ErrorClassFocusRequired,
+		State:      p.getCurrentState(caso, prog),
+	}
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"reflect"
+	"testing"
+)
+
+// focusCase tem uma gaveta dentro da mesa e um quadro solto na sala.
+func focusCase() *models.Case {
+	caso := testCase()
+	caso.Config.ObjectParents = map[string]string{"gaveta": "mesa", "carta": "gaveta"}
+	caso.CommandResponses = []models.CommandResponse{
+		{Command: "OLHAR MESA", Condition: "always", Response: "Uma mesa."},
+		{Command: "OLHAR GAVETA", Condition: "always", Response: "Uma gaveta."},
+		{Command: "OLHAR CARTA", Condition: "always", Response: "Uma carta."},
+		{Command: "OLHAR QUADRO", Condition: "always", Response: "Um quadro."},
+		{Command: "LER", Condition: "focus.mesa", Response: "Você lê o que está sobre a mesa."},
+	}
+	return caso
+}
+
+func TestLookAt(t *testing.T) {
+	caso := focusCase()
+	tests := []struct {
+		path   []string
+		object string
+		want   []string
+	}{
+		{nil, "mesa", []string{"mesa"}},
+		{[]string{"mesa"}, "GAVETA", []string{"mesa", "gaveta"}},
+		{[]string{"mesa", "gaveta"}, "carta", []string{"mesa", "gaveta", "carta"}},
+		{[]string{"mesa", "gaveta", "carta"}, "gaveta", []string{"mesa", "gaveta"}},
+		{[]string{"mesa", "gaveta"}, "quadro", []string{"quadro"}},
+	}
+
+	for _, tt := range tests {
+		prog := &models.Progression{CurrentFocus: "none"}
+		prog.SetFocusPath(tt.path)
+		lookAt(caso, prog, tt.object)
+		if got := prog.FocusPath(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lookAt(%v, %s) = %v, quer %v", tt.path, tt.object, got, tt.want)
+		}
+		if prog.CurrentFocus != tt.want[len(tt.want)-1] {
+			t.Errorf("CurrentFocus = %s, quer o topo da pilha", prog.CurrentFocus)
+		}
+	}
+}
+
+func TestFocusStack(t *testing.T) {
+	g := newTestGame(t, focusCase())
+
+	tests := []struct {
+		command string
+		success bool
+		focus   string
+	}{
+		{"OLHAR GAVETA", false, "none"},
+		{"OLHAR MESA", true, "mesa"},
+		{"OLHAR GAVETA", true, "gaveta"},
+		{"LER", true, "gaveta"},
+		{"OLHAR CARTA", true, "carta"},
+		{"VOLTAR", true, "gaveta"},
+		{"VOLTAR", true, "mesa"},
+		{"VOLTAR", true, "none"},
+		{"VOLTAR", true, "none"},
+		{"OLHAR QUADRO", true, "quadro"},
+		{"OLHAR GAVETA", false, "quadro"},
+	}
+
+	for _, tt := range tests {
+		resp := g.run(tt.command)
+		if resp.Success != tt.success {
+			t.Fatalf("%s: Success = %v, quer %v (%s)", tt.command, resp.Success, tt.success, resp.Error)
+		}
+		if !tt.success && resp.ErrorCode != models.ErrFocusRequired {
+			t.Errorf("%s: ErrorCode = %s", tt.command, resp.ErrorCode)
+		}
+		if g.prog.CurrentFocus != tt.focus {
+			t.Fatalf("%s: foco %s, quer %s", tt.command, g.prog.CurrentFocus, tt.focus)
+		}
+	}
+}
+
+func TestLookAroundListsReachable(t *testing.T) {
+	g := newTestGame(t, focusCase())
+
+	tests := []struct {
+		setup []string
+		want  string
+	}{
+		{nil, "Você olha ao redor. Objetos visíveis: MESA, QUADRO"},
+		{[]string{"OLHAR MESA"}, "Examinando MESA. Ao seu alcance: GAVETA, QUADRO"},
+		{[]string{"OLHAR GAVETA"}, "Examinando GAVETA. Ao seu alcance: CARTA, MESA, QUADRO"},
+	}
+
+	for _, tt := range tests {
+		for _, command := range tt.setup {
+			g.mustRun(command)
+		}
+		if resp := g.mustRun("OLHAR"); resp.Narrative != tt.want {
+			t.Errorf("depois de %v: %q, quer %q", tt.setup, resp.Narrative, tt.want)
+		}
+	}
+}
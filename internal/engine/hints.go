@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"time"
+)
+
+// handleHint revela a próxima dica do puzzle atual. Quando todas já foram
+// usadas, repete a última sem registrar um novo uso.
+func (p *GameProcessor) handleHint(caso *models.Case, prog *models.Progression) *models.GameResponse {
+	pz := findPuzzle(caso, prog.CurrentPuzzle)
+	if pz == nil || len(pz.Hints) == 0 {
+		return &models.GameResponse{
+			Success:   false,
+			Error:     "Não há dicas para este momento da investigação. Tente AJUDA.",
+			ErrorCode: models.ErrHintUnavailable,
+			State:     p.getCurrentState(caso, prog),
+		}
+	}
+
+	total := len(pz.Hints)
+	used := prog.HintsFor(pz.Number)
+	if used >= total {
+		last := pz.Hints[total-1]
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: fmt.Sprintf("Você já viu todas as dicas deste puzzle. A última foi:\n%s", last.Text),
+			Hint:      &models.HintResult{Tier: total, Total: total},
+			State:     p.getCurrentState(caso, prog),
+		}
+	}
+
+	hint := pz.Hints[used]
+	tier := used + 1
+	// o desconto fica gravado no uso, e a pontuação, a narrativa e a
+	// telemetria usam esse mesmo valor
+	penalty := hint.Penalty
+	if penalty <= 0 {
+		penalty = scoringFor(caso).HintPenalty
+	}
+	prog.HintsUsed = append(prog.HintsUsed, models.HintUse{
+		Timestamp: time.Now(),
+		Puzzle:    pz.Number,
+		Tier:      tier,
+		Penalty:   penalty,
+	})
+
+	narrative := fmt.Sprintf("Dica %d de %d: %s", tier, total, hint.Text)
+	if penalty > 0 {
+		narrative += fmt.Sprintf("\n(-%d pontos)", penalty)
+	}
+
+	return &models.GameResponse{
+		Success:   true,
+		Narrative: narrative,
+		Hint:      &models.HintResult{Tier: tier, Total: total, Penalty: penalty, New: true},
+		State:     p.getCurrentState(caso, prog),
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"testing"
+	"time"
+)
+
+func TestSandboxLimits(t *testing.T) {
+	limits := db.DefaultSandboxLimits()
+	limits.QueryTimeout = 100 * time.Millisecond
+	limits.MaxRows = 2
+	limits.MaxCellBytes = 8
+	limits.MaxCompoundSelect = 2
+	limits.MaxStatements = 2
+
+	tests := []struct {
+		name      string
+		command   string
+		errorCode string
+		truncated bool
+		cell      string
+	}{
+		{"dentro dos limites", "SELECT nome FROM suspeitos WHERE id <= 2", "", false, ""},
+		{"linhas demais", "SELECT nome FROM suspeitos", "", true, ""},
+		{"célula grande", "SELECT 'uma descrição longa' AS d", "", true, "uma desc…"},
+		{"script longo", "SELECT 1; SELECT 2; SELECT 3", models.ErrScriptTooLong, false, ""},
+		{"compound select", "SELECT 1 UNION SELECT 2 UNION SELECT 3", models.ErrInvalidSQL, false, ""},
+		{
+			"recursão sem fim",
+			"WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT COUNT(*) FROM n",
+			models.ErrQueryTimeout, false, "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGame(t, testCase())
+			g.p.SQLiteFactory.Limits = limits
+
+			start := time.Now()
+			resp := g.run(tt.command)
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("o comando levou %s", elapsed)
+			}
+
+			if tt.errorCode != "" {
+				if resp.Success || resp.ErrorCode != tt.errorCode {
+					t.Fatalf("Success = %v, ErrorCode = %q, quer %q (%s)", resp.Success, resp.ErrorCode, tt.errorCode, resp.Error)
+				}
+				return
+			}
+			if !resp.Success {
+				t.Fatalf("erro inesperado: %s", resp.Error)
+			}
+			result := resp.Data.(models.QueryResult)
+			if result.Truncated != tt.truncated || len(result.Rows) > limits.MaxRows {
+				t.Errorf("Truncated = %v com %d linhas, quer %v", result.Truncated, len(result.Rows), tt.truncated)
+			}
+			if tt.cell != "" && result.Rows[0][0] != tt.cell {
+				t.Errorf("célula = %q, quer %q", result.Rows[0][0], tt.cell)
+			}
+		})
+	}
+}
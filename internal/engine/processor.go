@@ -3,16 +3,20 @@ package engine
 import (
 	"casos-de-codigo-api/internal/db"
 	"casos-de-codigo-api/internal/models"
-	"database/sql"
+	"context"
 	"fmt"
+	"log"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 type GameProcessor struct {
 	SQLiteFactory *db.SQLiteFactory
 	Validator     *Validator
+
+	clockedCases sync.Map
 }
 
 func NewGameProcessor(factory *db.SQLiteFactory) *GameProcessor {
@@ -22,27 +26,72 @@ func NewGameProcessor(factory *db.SQLiteFactory) *GameProcessor {
 	}
 }
 
-func (p *GameProcessor) ProcessCommand(caso *models.Case, progression *models.Progression, command string) (*models.GameResponse, *models.SQLHistoryItem, error) {
+// ProcessCommand executa um comando de jogo ou SQL. Para SQL, devolve também
+// a classificação de cada comando do script, a mesma usada na validação e
+// no histórico, para quem registra a telemetria não classificar de novo.
+func (p *GameProcessor) ProcessCommand(caso *models.Case, progression *models.Progression, command string) (*models.GameResponse, []models.SQLHistoryItem, []SQLStatement, error) {
 	p.ensurePuzzleCheckpoint(progression, progression.CurrentPuzzle, len(progression.SQLHistory))
 
 	upperCommand := strings.ToUpper(strings.TrimSpace(command))
 
 	if response := p.handleGameCommand(caso, progression, upperCommand); response != nil {
-		return response, nil, nil
+		return response, nil, nil, nil
+	}
+
+	statements := splitSQLScript(command)
+	if len(statements) == 0 {
+		statements = []scriptStatement{{SQL: command, Stmt: ClassifySQL(command)}}
+	}
+	classified := make([]SQLStatement, 0, len(statements))
+	for _, s := range statements {
+		if s.Stmt.IsSQL() {
+			classified = append(classified, s.Stmt)
+		}
 	}
 
+	response, historyItems, err := p.processSQL(caso, progression, command, statements)
+	return response, historyItems, classified, err
+}
+
+func (p *GameProcessor) processSQL(caso *models.Case, progression *models.Progression, command string, statements []scriptStatement) (*models.GameResponse, []models.SQLHistoryItem, error) {
 	if err := p.Validator.ValidateSQLCommand(caso, progression, command); err != nil {
-		if apiErr, ok := err.(models.APIError); ok {
-			return &models.GameResponse{
-				Success: false,
-				Error:   apiErr.Message,
-				State:   p.getCurrentState(caso, progression),
-			}, nil, nil
+		return p.validationErrorResponse(caso, progression, err)
+	}
+
+	if limit := p.SQLiteFactory.Limits.MaxStatements; limit > 0 && len(statements) > limit {
+		return p.validationErrorResponse(caso, progression, models.APIError{
+			Message: fmt.Sprintf("O script tem %d comandos, mas o terminal aceita no máximo %d por execução.", len(statements), limit),
+			Code:    models.ErrScriptTooLong,
+		})
+	}
+
+	if len(statements) == 1 && isTransactionControl(statements[0].Stmt) {
+		return p.handleTransactionCommand(caso, progression, statements[0])
+	}
+
+	for _, s := range statements {
+		if isTransactionControl(s.Stmt) {
+			return p.transactionError(caso, progression, "BEGIN, COMMIT e ROLLBACK devem ser enviados sozinhos, fora de scripts.")
+		}
+		if err := p.Validator.ValidateStatement(caso, progression, s.Stmt); err != nil {
+			return p.validationErrorResponse(caso, progression, err)
 		}
-		return nil, nil, err
 	}
 
-	return p.executeSQL(caso, progression, command)
+	return p.executeSQL(caso, progression, statements)
+}
+
+func (p *GameProcessor) validationErrorResponse(caso *models.Case, progression *models.Progression, err error) (*models.GameResponse, []models.SQLHistoryItem, error) {
+	if apiErr, ok := err.(models.APIError); ok {
+		return &models.GameResponse{
+			Success:    false,
+			Error:      apiErr.Message,
+			ErrorCode:  apiErr.Code,
+			ErrorClass: errorClassForCode(apiErr.Code),
+			State:      p.getCurrentState(caso, progression),
+		}, nil, nil
+	}
+	return nil, nil, err
 }
 func (p *GameProcessor) handleLookList(
 	caso *models.Case,
@@ -66,6 +115,10 @@ func (p *GameProcessor) handleLookList(
 			continue
 		}
 
+		if !focusReachable(caso, prog, parts[1]) || strings.EqualFold(parts[1], prog.CurrentFocus) {
+			continue
+		}
+
 		obj := strings.ToUpper(parts[1])
 		objMap[obj] = true
 	}
@@ -86,6 +139,9 @@ func (p *GameProcessor) handleLookList(
 	sort.Strings(objects)
 
 	narrative := "Você olha ao redor. Objetos visíveis: " + strings.Join(objects, ", ")
+	if prog.CurrentFocus != "none" && prog.CurrentFocus != "" {
+		narrative = fmt.Sprintf("Examinando %s. Ao seu alcance: %s", strings.ToUpper(prog.CurrentFocus), strings.Join(objects, ", "))
+	}
 
 	return &models.GameResponse{
 		Success:   true,
@@ -112,9 +168,20 @@ func (p *GameProcessor) handleGameCommand(caso *models.Case, progression *models
 		if idx < 0 || idx > len(progression.SQLHistory) {
 			idx = len(progression.SQLHistory)
 		}
+		if otherPuzzleAfter(progression, idx) {
+			return &models.GameResponse{
+				Success:   false,
+				Error:     "Você trabalhou em outros puzzles depois de começar este, e o RESET PUZZLE desfaria esse trabalho também. Use DESFAZER para voltar os comandos recentes deste puzzle.",
+				ErrorCode: models.ErrResetUnavailable,
+				State:     p.getCurrentState(caso, progression),
+			}
+		}
 
 		progression.SQLHistory = progression.SQLHistory[:idx]
-		progression.CurrentFocus = "none"
+		progression.ClearFocus()
+		progression.PendingSQL = nil
+		progression.InTransaction = false
+		p.restoreStoryCheckpoint(progression)
 
 		return &models.GameResponse{
 			Success:   true,
@@ -123,11 +190,35 @@ func (p *GameProcessor) handleGameCommand(caso *models.Case, progression *models
 		}
 	}
 
+	if command == "VOLTAR" {
+		return p.handleBack(caso, progression)
+	}
+
+	if baseCmd == "DESFAZER" || baseCmd == "UNDO" {
+		return p.handleUndo(caso, progression, parts[1:])
+	}
+
+	if baseCmd == "ACUSAR" || baseCmd == "ACCUSE" {
+		return p.handleAccusation(caso, progression, parts[1:])
+	}
+
+	if baseCmd == "PUZZLES" || baseCmd == "PUZZLE" {
+		return p.handlePuzzleCommand(caso, progression, baseCmd, parts[1:])
+	}
+
+	if baseCmd == "DICA" || baseCmd == "HINT" {
+		return p.handleHint(caso, progression)
+	}
+
+	if baseCmd == "INVENTARIO" || baseCmd == "INVENTÁRIO" || baseCmd == "INV" || baseCmd == "INVENTORY" {
+		return p.handleInventory(caso, progression)
+	}
+
 	if baseCmd == "AJUDA" || baseCmd == "HELP" || baseCmd == "/AJUDA" || baseCmd == "/HELP" {
 		if len(parts) > 1 {
 			topic := parts[1]
 			for _, ht := range caso.HelpTexts {
-				if strings.EqualFold(ht.Topic, topic) && (ht.Puzzle == 0 || ht.Puzzle == progression.CurrentPuzzle) {
+				if strings.EqualFold(ht.Topic, topic) && (ht.Puzzle == 0 || ht.Puzzle == progression.CurrentPuzzle) && ht.Available(progressionState{progression}) {
 					return &models.GameResponse{
 						Success:   true,
 						Narrative: ht.Content,
@@ -160,32 +251,47 @@ func (p *GameProcessor) handleGameCommand(caso *models.Case, progression *models
 	}
 
 	if bestMatch != nil {
-		newFocus := progression.CurrentFocus
 		if strings.HasPrefix(command, "OLHAR") && len(parts) > 1 {
-			newFocus = strings.ToLower(parts[1])
+			if !focusReachable(caso, progression, parts[1]) {
+				return p.unreachableResponse(caso, progression, parts[1])
+			}
+			lookAt(caso, progression, parts[1])
+			markVisited(progression, progression.CurrentFocus)
 		}
 
 		if command == "SAIR" || command == "FECHAR" || command == "PARAR" {
-			newFocus = "none"
+			progression.ClearFocus()
 		}
 
-		progression.CurrentFocus = newFocus
+		narrative := bestMatch.Response
+		if added := applyStoryEffects(progression, bestMatch); len(added) > 0 {
+			narrative += pickedUpNarrative(caso, added)
+		}
 		state := p.getCurrentState(caso, progression)
 
+		var ending *models.Ending
 		if bestMatch.UnlocksNext {
-			progression.CurrentPuzzle = bestMatch.NextPuzzle
-			progression.CurrentFocus = "none"
+			ending = p.advancePuzzle(caso, progression, bestMatch.NextPuzzle, len(progression.SQLHistory))
 			state = p.getCurrentState(caso, progression)
 		}
 
 		return &models.GameResponse{
 			Success:   true,
-			Narrative: bestMatch.Response,
+			Narrative: endingNarrative(narrative, ending),
 			ImageKey:  bestMatch.ImageKey,
+			Ending:    ending,
 			State:     state,
 		}
 	}
 
+	if parts[0] == "PEGAR" && len(parts) > 1 {
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: "Não há nada com esse nome que valha a pena levar.",
+			State:     p.getCurrentState(caso, progression),
+		}
+	}
+
 	if parts[0] == "OLHAR" && len(parts) > 1 {
 		return &models.GameResponse{
 			Success: true,
@@ -200,181 +306,308 @@ Tente o comando "OLHAR" para listar os objetos disponíveis.`,
 }
 
 func (p *GameProcessor) checkCondition(resp models.CommandResponse, prog *models.Progression) bool {
-	switch resp.Condition {
-	case "always":
-		return true
-	case "puzzle_state":
-		return fmt.Sprintf("%d", prog.CurrentPuzzle) == resp.Value
-	case "puzzle_state_not":
-		return fmt.Sprintf("%d", prog.CurrentPuzzle) != resp.Value
-	case "puzzle_state_less":
-		val := 0
-		fmt.Sscanf(resp.Value, "%d", &val)
-		return prog.CurrentPuzzle < val
-	case "puzzle_state_greater":
-		val := 0
-		fmt.Sscanf(resp.Value, "%d", &val)
-		return prog.CurrentPuzzle > val
-	case "current_focus_none":
-		return prog.CurrentFocus == "none"
-	default:
-		return false
-	}
+	return resp.Matches(progressionState{prog})
 }
 
 func (p *GameProcessor) executeSQL(
 	caso *models.Case,
 	progression *models.Progression,
-	query string,
-) (*models.GameResponse, *models.SQLHistoryItem, error) {
+	statements []scriptStatement,
+) (*models.GameResponse, []models.SQLHistoryItem, error) {
 
-	dbInstance, err := p.SQLiteFactory.CreateInMemoryDB(caso, progression)
+	dbInstance, err := p.openSandbox(caso, progression)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer dbInstance.Close()
 
-	_, _ = dbInstance.Exec(`PRAGMA case_sensitive_like = OFF`)
+	now := worldNow(caso, progression)
+	historyLen := len(progression.EffectiveHistory())
 
-	normalizedQuery := NormalizeSQL(query)
+	puzzle := findPuzzle(caso, progression.CurrentPuzzle)
+	dbInstance.Policy.Restrict(puzzleRestrictions(puzzle))
 
-	upper := strings.ToUpper(strings.TrimSpace(query))
-	isSelect := strings.HasPrefix(upper, "SELECT")
+	isScript := len(statements) > 1
+	isSelect := true
 
 	var data interface{}
-	var historyItem *models.SQLHistoryItem
+	results := make([]models.StatementResult, 0, len(statements))
+	historyItems := make([]models.SQLHistoryItem, 0)
 
-	if isSelect {
-		rows, err := dbInstance.Query(normalizedQuery)
-		if err != nil {
-			return &models.GameResponse{
-				Success: false,
-				Error:   err.Error(),
-				State:   p.getCurrentState(caso, progression),
-			}, nil, nil
+	for i, s := range statements {
+		dbInstance.SeedStatement(progression.RandomSeed(), historyLen+len(historyItems))
+		result, item, errResp := p.executeStatement(caso, progression, dbInstance, s, now)
+		result.Index = i + 1
+
+		if errResp != nil {
+			if !isScript {
+				return errResp, nil, nil
+			}
+			// o script é tudo ou nada: nenhum comando é gravado no histórico
+			result.Error = errResp.Error
+			result.ErrorCode = errResp.ErrorCode
+			result.ErrorClass = errResp.ErrorClass
+			result.ErrorDetail = errResp.ErrorDetail
+			errResp.Error = fmt.Sprintf("O comando %d do script falhou e nenhuma alteração foi salva. %s", i+1, errResp.Error)
+			errResp.Statements = append(results, result)
+			return errResp, nil, nil
+		}
+
+		results = append(results, result)
+		if s.Stmt.ReadOnly {
+			data = result.Data
+		} else {
+			isSelect = false
+		}
+		if item != nil {
+			historyItems = append(historyItems, *item)
 		}
-		defer rows.Close()
-		data = p.serializeRows(rows)
-	} else {
-		_, err = dbInstance.Exec(normalizedQuery)
+	}
+
+	if len(historyItems) > 0 {
+		// só o último item do comando pode virar ponto de verificação (veja
+		// checksumPoints); os do meio de um script ficam sem checksum
+		checksum, err := p.stateChecksum(caso, progression, dbInstance)
 		if err != nil {
+			log.Printf("Erro: Falha ao calcular checksum do sandbox: %v", err)
 			return &models.GameResponse{
-				Success: false,
-				Error:   err.Error(),
-				State:   p.getCurrentState(caso, progression),
+				Success:   false,
+				Error:     "Não foi possível registrar o estado do banco após o comando, e ele não foi salvo. Tente novamente.",
+				ErrorCode: models.ErrInternalError,
+				State:     p.getCurrentState(caso, progression),
 			}, nil, nil
 		}
-		historyItem = &models.SQLHistoryItem{
-			Timestamp:   time.Now(),
-			Query:       query,
-			PuzzleState: progression.CurrentPuzzle,
-			FocusState:  progression.CurrentFocus,
-		}
+		historyItems[len(historyItems)-1].Checksum = checksum
+
+		effective := progression.EffectiveHistory()
+		history := append(effective[:len(effective):len(effective)], historyItems...)
+		p.SQLiteFactory.StoreSnapshot(caso, progression, dbInstance, history)
+	}
+
+	staged := progression.InTransaction
+	if staged && len(historyItems) > 0 {
+		progression.PendingSQL = append(progression.PendingSQL, historyItems...)
+		historyItems = nil
 	}
 
-	valRes, valType := p.runValidations(caso, progression, dbInstance, data, historyItem)
+	var changes *models.DMLChanges
+	if !isScript {
+		changes = results[0].Changes
+	}
+
+	ctx, cancel := p.SQLiteFactory.CommandContext()
+	defer cancel()
+
+	valRes, valType := p.runValidations(ctx, caso, progression, dbInstance, data, len(historyItems), staged)
 	if valRes != nil {
-		if isSelect && valType != "result_check" && valRes.Error == "" {
+		if isSelect && valType != validationResultCheck && valRes.Error == "" {
 			if valRes.State.CurrentPuzzle == progression.CurrentPuzzle {
 				valRes.Narrative = "Você executa a consulta. As linhas começam a surgir no monitor, frias e impessoais como qualquer outro log do DITEC."
 			}
 		}
-		return valRes, historyItem, nil
+		if isScript {
+			valRes.Statements = results
+		}
+		valRes.Changes = changes
+		return valRes, historyItems, nil
 	}
 
 	msg := "Comando executado com sucesso. O banco de dados foi atualizado."
+	if changes != nil {
+		msg = fmt.Sprintf("Comando executado com sucesso. O banco de dados foi atualizado (%d linha(s) afetada(s)).", changes.RowsAffected)
+	}
+	if staged {
+		msg = "Comando executado dentro da transação. A alteração fica pendente até o COMMIT."
+	}
 	if isSelect {
 		msg = "Você executa a consulta. As linhas começam a surgir no monitor, frias e impessoais como qualquer outro log do DITEC."
 	}
 
 	state := p.getCurrentState(caso, progression)
 
-	return &models.GameResponse{
+	response := &models.GameResponse{
 		Success:   true,
 		Narrative: msg,
 		Data:      data,
+		Changes:   changes,
 		ImageKey:  "",
 		State:     state,
-	}, historyItem, nil
+	}
+	if isScript {
+		response.Statements = results
+	}
+	return response, historyItems, nil
+}
+
+// executeStatement roda um único comando no sandbox, com seu próprio limite
+// de tempo. Comandos que alteram o banco geram o item de histórico.
+func (p *GameProcessor) executeStatement(
+	caso *models.Case,
+	progression *models.Progression,
+	dbInstance *db.Sandbox,
+	s scriptStatement,
+	now time.Time,
+) (models.StatementResult, *models.SQLHistoryItem, *models.GameResponse) {
+
+	ctx, cancel := p.SQLiteFactory.CommandContext()
+	defer cancel()
+
+	normalizedQuery := applyWorldClock(NormalizeSQL(s.SQL), now)
+	result := models.StatementResult{SQL: s.SQL, Kind: string(s.Stmt.Kind)}
+
+	if s.Stmt.ReadOnly {
+		rows, err := dbInstance.QueryContext(ctx, normalizedQuery)
+		if err != nil {
+			return result, nil, p.executionErrorResponse(ctx, caso, progression, dbInstance, err)
+		}
+		data, err := p.serializeRows(rows)
+		rows.Close()
+		if err != nil {
+			return result, nil, p.executionErrorResponse(ctx, caso, progression, dbInstance, err)
+		}
+		result.Success = true
+		result.Data = data
+		return result, nil, nil
+	}
+
+	var diff *dmlDiff
+	if s.Stmt.IsDML() {
+		diff = p.beginDiff(ctx, dbInstance, s.Stmt, normalizedQuery)
+	}
+
+	res, err := dbInstance.ExecContext(ctx, normalizedQuery)
+	if err != nil {
+		return result, nil, p.executionErrorResponse(ctx, caso, progression, dbInstance, err)
+	}
+	if affected, err := res.RowsAffected(); err == nil {
+		result.RowsAffected = affected
+	}
+	if diff != nil {
+		result.Changes = p.finishDiff(ctx, dbInstance, diff, result.RowsAffected)
+	}
+	result.Success = true
+
+	return result, &models.SQLHistoryItem{
+		Timestamp:   time.Now(),
+		Query:       s.SQL,
+		Normalized:  normalizedQuery,
+		PuzzleState: progression.CurrentPuzzle,
+		FocusState:  progression.CurrentFocus,
+	}, nil
+}
+
+// stateChecksum calcula o checksum gravado com o item de histórico. Ele tem
+// seu próprio limite de tempo, para não herdar o que sobrou de um comando
+// lento, e é tentado duas vezes: um item sem checksum nunca seria conferido.
+func (p *GameProcessor) stateChecksum(caso *models.Case, progression *models.Progression, dbInstance *db.Sandbox) (string, error) {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		ctx, cancel := p.SQLiteFactory.CommandContext()
+		var checksum string
+		checksum, err = dbInstance.StateChecksum(ctx, caso, progression.CurrentPuzzle)
+		cancel()
+		if err == nil {
+			return checksum, nil
+		}
+	}
+	return "", err
 }
 
+// runValidations avalia as validações do puzzle atual sempre na mesma ordem:
+//  1. as validações são agrupadas por Group, na ordem em que cada grupo
+//     aparece no caso; validações sem Group formam grupos de um item só;
+//  2. todas as condições de um grupo são avaliadas e precisam passar (E);
+//  3. o primeiro grupo satisfeito vence (OU entre grupos) e sua primeira
+//     validação define narrativa, imagens e desbloqueio;
+//  4. sem grupo satisfeito, responde o primeiro grupo cuja primeira validação
+//     tem FailureNarrative, listando as condições ainda pendentes.
+//
+// Grupos com result_check são ignorados quando o comando não foi um SELECT;
+// quando falham, o primeiro feedback parcial gerado acompanha a resposta.
 func (p *GameProcessor) runValidations(
+	ctx context.Context,
 	caso *models.Case,
 	prog *models.Progression,
-	dbInstance *sql.DB,
+	dbInstance *db.Sandbox,
 	lastData interface{},
-	pendingHistory *models.SQLHistoryItem,
+	pendingItems int,
+	staged bool,
 ) (*models.GameResponse, string) {
 
-	for _, v := range caso.Validations {
-		if v.Puzzle == prog.CurrentPuzzle {
-			var passed bool
-			var count interface{}
-			err := dbInstance.QueryRow(v.CheckSQL).Scan(&count)
+	var failed *groupOutcome
+	var feedback *models.ResultFeedback
 
-			if err == nil && fmt.Sprintf("%v", count) == v.ExpectValue {
-				passed = true
-			}
+	for _, group := range validationGroups(caso.Validations, prog.CurrentPuzzle) {
+		outcome := p.evaluateGroup(ctx, dbInstance, group, lastData, worldNow(caso, prog))
+		if outcome.skipped {
+			continue
+		}
 
-			if passed {
-				if v.UnlocksNext {
-					prog.CurrentPuzzle = v.NextPuzzle
-					prog.CurrentFocus = "none"
+		lead := group[0]
 
-					effectiveLen := len(prog.SQLHistory)
-					if pendingHistory != nil && strings.TrimSpace(pendingHistory.Query) != "" {
-						effectiveLen++
-					}
-					p.ensurePuzzleCheckpoint(prog, prog.CurrentPuzzle, effectiveLen)
-				}
+		if outcome.passed && staged && lead.UnlocksNext {
+			// o puzzle só avança quando a transação for confirmada
+			return &models.GameResponse{
+				Success:   true,
+				Narrative: "Os dados parecem corretos, mas as alterações ainda estão pendentes. Use COMMIT para confirmá-las.",
+				Data:      lastData,
+				State:     p.getCurrentState(caso, prog),
+			}, outcome.kind
+		}
 
-				state := p.getCurrentState(caso, prog)
-				return &models.GameResponse{
-					Success:         true,
-					Narrative:       v.SuccessNarrative,
-					SuccessImageKey: v.SuccessImageKey,
-					ImageKey:        "",
-					Data:            lastData,
-					State:           state,
-				}, v.Type
-			} else if v.FailureNarrative != "" {
-				return &models.GameResponse{
-					Success:         true,
-					Narrative:       v.FailureNarrative,
-					FailureImageKey: v.FailureImageKey,
-					Data:            lastData,
-					State:           p.getCurrentState(caso, prog),
-				}, v.Type
+		if outcome.passed {
+			var ending *models.Ending
+			if lead.UnlocksNext {
+				ending = p.advancePuzzle(caso, prog, lead.NextPuzzle, len(prog.SQLHistory)+pendingItems)
 			}
-		}
-	}
-	return nil, ""
-}
 
-func (p *GameProcessor) serializeRows(rows *sql.Rows) models.QueryResult {
-	cols, _ := rows.Columns()
+			state := p.getCurrentState(caso, prog)
+			return &models.GameResponse{
+				Success:         true,
+				Narrative:       endingNarrative(lead.SuccessNarrative, ending),
+				Ending:          ending,
+				SuccessImageKey: lead.SuccessImageKey,
+				ImageKey:        "",
+				Data:            lastData,
+				State:           state,
+			}, outcome.kind
+		}
 
-	results := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		columns := make([]interface{}, len(cols))
-		columnPointers := make([]interface{}, len(cols))
-		for i := range columns {
-			columnPointers[i] = &columns[i]
+		if failed == nil && lead.FailureNarrative != "" {
+			failed = &outcome
+		}
+		if feedback == nil {
+			feedback = outcome.feedback
 		}
-		_ = rows.Scan(columnPointers...)
+	}
 
-		m := make(map[string]interface{})
-		for i, colName := range cols {
-			val := columnPointers[i].(*interface{})
-			m[colName] = *val
+	if failed != nil {
+		lead := failed.group[0]
+		if failed.feedback != nil {
+			feedback = failed.feedback
 		}
-		results = append(results, m)
+		return &models.GameResponse{
+			Success:         true,
+			Narrative:       lead.FailureNarrative,
+			FailureImageKey: lead.FailureImageKey,
+			Data:            lastData,
+			Unmet:           failed.unmet,
+			Feedback:        feedback,
+			State:           p.getCurrentState(caso, prog),
+		}, failed.kind
 	}
 
-	return models.QueryResult{
-		Columns: cols,
-		Rows:    results,
+	if feedback != nil {
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: "Você executa a consulta, mas o resultado ainda não é o que a investigação precisa.",
+			Data:      lastData,
+			Feedback:  feedback,
+			State:     p.getCurrentState(caso, prog),
+		}, validationResultCheck
 	}
+
+	return nil, ""
 }
 
 func (p *GameProcessor) getCurrentState(caso *models.Case, prog *models.Progression) models.GameState {
@@ -382,6 +615,18 @@ func (p *GameProcessor) getCurrentState(caso *models.Case, prog *models.Progress
 		CaseID:        prog.CaseID,
 		CurrentPuzzle: prog.CurrentPuzzle,
 		CurrentFocus:  prog.CurrentFocus,
+		FocusPath:     prog.FocusPath(),
+		InTransaction: prog.InTransaction,
+		PendingCount:  len(prog.PendingSQL),
+		Diverged:      prog.Diverged,
+		Inventory:     prog.Inventory,
+		Solved:        prog.Solved,
+		Completed:     prog.Completed,
+		Ending:        prog.Ending,
+		Outcome:       prog.Outcome,
+	}
+	if usesPuzzleGraph(caso) {
+		state.Available = availablePuzzles(caso, prog)
 	}
 	for _, pz := range caso.Puzzles {
 		if pz.Number == prog.CurrentPuzzle {
@@ -398,10 +643,25 @@ func (p *GameProcessor) ensurePuzzleCheckpoint(prog *models.Progression, puzzle
 	if prog.PuzzleCheckpoints == nil {
 		prog.PuzzleCheckpoints = map[string]int{}
 	}
+	if prog.StoryCheckpoints == nil {
+		prog.StoryCheckpoints = map[string]models.StoryState{}
+	}
 	key := fmt.Sprintf("%d", puzzle)
 	if _, exists := prog.PuzzleCheckpoints[key]; !exists {
 		prog.PuzzleCheckpoints[key] = historyLen
 	}
+	if _, exists := prog.StoryCheckpoints[key]; !exists {
+		prog.StoryCheckpoints[key] = prog.StoryState.Clone()
+	}
+	startPuzzleClock(prog, puzzle)
+}
+
+// restoreStoryCheckpoint devolve flags, contadores e inventário ao que eram
+// no início do puzzle atual.
+func (p *GameProcessor) restoreStoryCheckpoint(prog *models.Progression) {
+	if story, ok := prog.StoryCheckpoints[fmt.Sprintf("%d", prog.CurrentPuzzle)]; ok {
+		prog.StoryState = story.Clone()
+	}
 }
 
 func (p *GameProcessor) getPuzzleCheckpoint(prog *models.Progression, puzzle int) int {
@@ -415,3 +675,15 @@ func (p *GameProcessor) getPuzzleCheckpoint(prog *models.Progression, puzzle int
 	}
 	return v
 }
+
+// otherPuzzleAfter diz se o histórico, a partir de from, tem comandos de
+// outro puzzle. Com puzzles em paralelo, o trecho depois do checkpoint pode
+// misturar o trabalho de várias frentes, e truncá-lo levaria as duas.
+func otherPuzzleAfter(prog *models.Progression, from int) bool {
+	for _, item := range prog.SQLHistory[min(from, len(prog.SQLHistory)):] {
+		if item.PuzzleState != prog.CurrentPuzzle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testCase é um caso linear de dois puzzles: prender Bruno abre o puzzle 2.
+func testCase() *models.Case {
+	return &models.Case{
+		ID:      "caso_teste",
+		Version: 1,
+		Config:  models.CaseConfig{StartingPuzzle: 1},
+		Puzzles: []models.Puzzle{
+			{Number: 1, Tables: []string{"suspeitos"}, Narrative: "P1"},
+			{Number: 2, Tables: []string{"suspeitos", "pistas"}, Narrative: "P2"},
+		},
+		Schemas: []models.Schema{
+			{
+				Puzzle:    1,
+				TableName: "suspeitos",
+				CreateSQL: "CREATE TABLE suspeitos (id INTEGER PRIMARY KEY, nome TEXT, cargo TEXT, preso INTEGER DEFAULT 0)",
+				InsertSQL: "INSERT INTO suspeitos (nome, cargo) VALUES ('Ana', 'Analista'), ('Bruno', 'Chefe'), ('Carla', 'Estagiária')",
+			},
+			{
+				Puzzle:    2,
+				TableName: "pistas",
+				CreateSQL: "CREATE TABLE pistas (id INTEGER PRIMARY KEY, suspeito_id INTEGER, descricao TEXT)",
+				InsertSQL: "INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'cabelo'), (2, 'pegada')",
+			},
+		},
+		Validations: []models.Validation{
+			{
+				Puzzle:           1,
+				CheckSQL:         "SELECT COUNT(*) FROM suspeitos WHERE preso = 1 AND nome = 'Bruno'",
+				ExpectValue:      "1",
+				SuccessNarrative: "Bruno foi preso.",
+				UnlocksNext:      true,
+				NextPuzzle:       2,
+			},
+		},
+	}
+}
+
+// testGame faz o papel do handler: aplica a resposta do processador à
+// progressão como ela seria gravada no Mongo.
+type testGame struct {
+	t    *testing.T
+	p    *GameProcessor
+	caso *models.Case
+	prog *models.Progression
+}
+
+func newTestGame(t *testing.T, caso *models.Case) *testGame {
+	t.Helper()
+	if errs := caso.CompileConditions(); len(errs) > 0 {
+		t.Fatalf("condições inválidas: %v", errs)
+	}
+	return &testGame{
+		t:    t,
+		p:    NewGameProcessor(db.NewSQLiteFactory()),
+		caso: caso,
+		prog: &models.Progression{
+			UserID:        primitive.NewObjectID(),
+			CaseID:        caso.ID,
+			CurrentPuzzle: caso.Config.StartingPuzzle,
+			CurrentFocus:  "none",
+			CreatedAt:     time.Now(),
+		},
+	}
+}
+
+func (g *testGame) run(command string) *models.GameResponse {
+	g.t.Helper()
+	resp, items, _, err := g.p.ProcessCommand(g.caso, g.prog, command)
+	if err != nil {
+		g.t.Fatalf("%s: %v", command, err)
+	}
+	if resp.Success {
+		g.prog.CurrentPuzzle = resp.State.CurrentPuzzle
+		g.prog.CurrentFocus = resp.State.CurrentFocus
+		if !resp.IsDebug {
+			g.prog.SQLHistory = append(g.prog.SQLHistory, items...)
+		}
+	}
+	return resp
+}
+
+// mustRun falha o teste se o comando não tiver sucesso.
+func (g *testGame) mustRun(command string) *models.GameResponse {
+	g.t.Helper()
+	resp := g.run(command)
+	if !resp.Success {
+		g.t.Fatalf("%s: %s", command, resp.Error)
+	}
+	return resp
+}
+
+// restart troca o processador por um novo, sem nenhum snapshot em cache,
+// como depois de reiniciar o servidor.
+func (g *testGame) restart() {
+	g.p = NewGameProcessor(db.NewSQLiteFactory())
+}
+
+// column devolve a primeira coluna do resultado de um SELECT.
+func (g *testGame) column(query string) []interface{} {
+	g.t.Helper()
+	resp := g.mustRun(query)
+	result, ok := resp.Data.(models.QueryResult)
+	if !ok {
+		g.t.Fatalf("%s: resultado inesperado %T", query, resp.Data)
+	}
+	values := make([]interface{}, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		values = append(values, row[0])
+	}
+	return values
+}
+
+func TestProcessCommandStatements(t *testing.T) {
+	tests := []struct {
+		command string
+		kinds   []StatementKind
+	}{
+		{"OLHAR", nil},
+		{"SELECT nome FROM suspeitos", []StatementKind{StmtSelect}},
+		{"UPDATE suspeitos SET cargo = 'X' WHERE id = 1; SELECT * FROM suspeitos", []StatementKind{StmtUpdate, StmtSelect}},
+		{"SELECIONE tudo", []StatementKind{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			g := newTestGame(t, testCase())
+			_, _, statements, err := g.p.ProcessCommand(g.caso, g.prog, tt.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kinds []StatementKind
+			if statements != nil {
+				kinds = make([]StatementKind, 0, len(statements))
+				for _, s := range statements {
+					kinds = append(kinds, s.Kind)
+				}
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("kinds = %v, quer %v", kinds, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestLegacyConditionsAreLenient(t *testing.T) {
+	caso := testCase()
+	caso.CommandResponses = []models.CommandResponse{
+		{Command: "ANOTAR", Condition: "puzzle_state", Value: "um", Response: "valor inválido"},
+		{Command: "ANOTAR", Condition: "puzzle_estado", Value: "1", Response: "nome desconhecido"},
+		{Command: "ANOTAR", Condition: "puzzle_state", Value: "1", Response: "Anotado."},
+	}
+	if errs := caso.CompileConditions(); len(errs) > 0 {
+		t.Fatalf("condições antigas não deveriam barrar o caso: %v", errs)
+	}
+
+	g := newTestGame(t, caso)
+	if resp := g.mustRun("ANOTAR"); resp.Narrative != "Anotado." {
+		t.Errorf("Narrative = %q, quer Anotado.", resp.Narrative)
+	}
+
+	// a sintaxe nova continua com erro
+	caso = testCase()
+	caso.CommandResponses = []models.CommandResponse{{Command: "ANOTAR", Condition: "puzzle = 'um'"}}
+	if errs := caso.CompileConditions(); len(errs) != 1 {
+		t.Errorf("erros = %v, quer 1", errs)
+	}
+}
+
+// o classificador e o authorizer usam a mesma lista de PRAGMAs
+func TestReadOnlyPragmas(t *testing.T) {
+	g := newTestGame(t, testCase())
+	for _, command := range []string{"PRAGMA integrity_check", "PRAGMA table_info(suspeitos)", "PRAGMA foreign_keys"} {
+		g.mustRun(command)
+	}
+	if resp := g.run("PRAGMA foreign_keys = OFF"); resp.Success {
+		t.Error("PRAGMA de escrita deveria ser recusado")
+	}
+}
@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// usesPuzzleGraph diz se algum puzzle declara pré-requisitos ou final.
+// Casos antigos seguem a sequência linear de NextPuzzle.
+func usesPuzzleGraph(caso *models.Case) bool {
+	for _, pz := range caso.Puzzles {
+		if len(pz.Prerequisites) > 0 || pz.Ending != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isSolved(prog *models.Progression, puzzle int) bool {
+	for _, n := range prog.Solved {
+		if n == puzzle {
+			return true
+		}
+	}
+	return false
+}
+
+func markSolved(prog *models.Progression, puzzle int) {
+	if puzzle == 0 || isSolved(prog, puzzle) {
+		return
+	}
+	prog.Solved = append(prog.Solved, puzzle)
+	stopPuzzleClock(prog, puzzle)
+}
+
+func prerequisitesMet(prog *models.Progression, pz *models.Puzzle) bool {
+	for _, req := range pz.Prerequisites {
+		if !isSolved(prog, req) {
+			return false
+		}
+	}
+	return true
+}
+
+// availablePuzzles lista, na ordem do caso, os puzzles ainda não resolvidos
+// cujos pré-requisitos já foram cumpridos. Puzzles terminais ficam de fora:
+// só se chega a eles ao resolver outro puzzle.
+func availablePuzzles(caso *models.Case, prog *models.Progression) []int {
+	available := make([]int, 0)
+	for i := range caso.Puzzles {
+		pz := &caso.Puzzles[i]
+		if pz.Ending == "" && !isSolved(prog, pz.Number) && prerequisitesMet(prog, pz) {
+			available = append(available, pz.Number)
+		}
+	}
+	return available
+}
+
+func findEnding(caso *models.Case, id string) *models.Ending {
+	for i := range caso.Endings {
+		if strings.EqualFold(caso.Endings[i].ID, id) {
+			return &caso.Endings[i]
+		}
+	}
+	return &models.Ending{ID: id, Title: id}
+}
+
+// advancePuzzle resolve o puzzle atual e escolhe o próximo: next, se ele
+// estiver liberado; senão o primeiro puzzle disponível; senão um puzzle
+// terminal cujos pré-requisitos foram cumpridos. Devolve o final alcançado,
+// se houver.
+func (p *GameProcessor) advancePuzzle(caso *models.Case, prog *models.Progression, next int, historyLen int) *models.Ending {
+	markSolved(prog, prog.CurrentPuzzle)
+	prog.ClearFocus()
+
+	if !usesPuzzleGraph(caso) {
+		prog.CurrentPuzzle = next
+		p.ensurePuzzleCheckpoint(prog, prog.CurrentPuzzle, historyLen)
+		// sem acusação configurada, passar do último puzzle encerra o caso
+		if caso.Accusation == nil && prog.CurrentPuzzle >= len(caso.Puzzles) {
+			completeCase(prog)
+		}
+		return nil
+	}
+
+	target := 0
+	if pz := findPuzzle(caso, next); pz != nil && !isSolved(prog, next) && prerequisitesMet(prog, pz) {
+		target = next
+	}
+	if target == 0 {
+		if available := availablePuzzles(caso, prog); len(available) > 0 {
+			target = available[0]
+		}
+	}
+	if target == 0 {
+		for i := range caso.Puzzles {
+			pz := &caso.Puzzles[i]
+			if pz.Ending != "" && prerequisitesMet(prog, pz) {
+				target = pz.Number
+				break
+			}
+		}
+	}
+	if target == 0 {
+		// nada mais liberado: o jogador continua no puzzle que acabou de resolver
+		return nil
+	}
+
+	prog.CurrentPuzzle = target
+	p.ensurePuzzleCheckpoint(prog, prog.CurrentPuzzle, historyLen)
+
+	pz := findPuzzle(caso, target)
+	if pz.Ending == "" {
+		return nil
+	}
+
+	prog.Ending = pz.Ending
+	completeCase(prog)
+	return findEnding(caso, pz.Ending)
+}
+
+// endingNarrative acrescenta o texto do final à narrativa do comando que o
+// alcançou.
+func endingNarrative(narrative string, ending *models.Ending) string {
+	if ending == nil || ending.Narrative == "" {
+		return narrative
+	}
+	if narrative == "" {
+		return ending.Narrative
+	}
+	return narrative + "\n\n" + ending.Narrative
+}
+
+// handlePuzzleCommand trata PUZZLES (lista) e PUZZLE <n> (troca o puzzle em
+// que o jogador trabalha entre os disponíveis).
+func (p *GameProcessor) handlePuzzleCommand(caso *models.Case, prog *models.Progression, cmd string, args []string) *models.GameResponse {
+	puzzleError := func(message string) *models.GameResponse {
+		return &models.GameResponse{
+			Success:   false,
+			Error:     message,
+			ErrorCode: models.ErrPuzzleUnavailable,
+			State:     p.getCurrentState(caso, prog),
+		}
+	}
+
+	if !usesPuzzleGraph(caso) {
+		return puzzleError("Nesta investigação os puzzles seguem uma ordem fixa.")
+	}
+
+	usage := "Use PUZZLES para ver as frentes abertas e PUZZLE <n> para trocar de frente."
+	if cmd == "PUZZLES" && len(args) > 0 {
+		return puzzleError(usage)
+	}
+
+	available := availablePuzzles(caso, prog)
+
+	if len(args) == 0 {
+		lines := make([]string, 0, len(caso.Puzzles))
+		for _, n := range available {
+			marker := ""
+			if n == prog.CurrentPuzzle {
+				marker = " (atual)"
+			}
+			lines = append(lines, fmt.Sprintf("- Puzzle %d%s", n, marker))
+		}
+		solved := append([]int(nil), prog.Solved...)
+		sort.Ints(solved)
+		narrative := "Frentes de investigação abertas:\n" + strings.Join(lines, "\n")
+		if len(lines) == 0 {
+			narrative = "Não há frentes de investigação abertas no momento."
+		}
+		if len(solved) > 0 {
+			names := make([]string, 0, len(solved))
+			for _, n := range solved {
+				names = append(names, strconv.Itoa(n))
+			}
+			narrative += "\nResolvidos: " + strings.Join(names, ", ")
+		}
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: narrative,
+			State:     p.getCurrentState(caso, prog),
+		}
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || len(args) > 1 {
+		return puzzleError(usage)
+	}
+	if prog.InTransaction {
+		return puzzleError("Há uma transação aberta. Use COMMIT ou ROLLBACK antes de trocar de puzzle.")
+	}
+	if n == prog.CurrentPuzzle {
+		return puzzleError(fmt.Sprintf("Você já está no puzzle %d.", n))
+	}
+
+	open := false
+	for _, a := range available {
+		open = open || a == n
+	}
+	if !open {
+		return puzzleError(fmt.Sprintf("O puzzle %d não está disponível agora.", n))
+	}
+
+	prog.CurrentPuzzle = n
+	prog.ClearFocus()
+	p.ensurePuzzleCheckpoint(prog, n, len(prog.SQLHistory))
+
+	state := p.getCurrentState(caso, prog)
+	return &models.GameResponse{
+		Success:   true,
+		Narrative: state.Narrative,
+		State:     state,
+	}
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"reflect"
+	"testing"
+)
+
+// graphCase abre os puzzles 2 e 3 em paralelo depois do 1; resolver os dois
+// leva ao final do puzzle 4.
+func graphCase() *models.Case {
+	caso := testCase()
+	caso.Puzzles = []models.Puzzle{
+		{Number: 1, Tables: []string{"suspeitos"}, Narrative: "P1"},
+		{Number: 2, Tables: []string{"suspeitos", "pistas"}, Narrative: "P2", Prerequisites: []int{1}},
+		{Number: 3, Tables: []string{"suspeitos", "pistas"}, Narrative: "P3", Prerequisites: []int{1}},
+		{Number: 4, Ending: "bom", Prerequisites: []int{2, 3}},
+	}
+	caso.Endings = []models.Ending{{ID: "bom", Title: "Justiça", Narrative: "O caso está encerrado."}}
+	caso.CommandResponses = []models.CommandResponse{
+		{Command: "RESOLVER", Condition: "puzzle IN (2, 3)", Response: "Resolvido.", UnlocksNext: true, NextPuzzle: 4},
+	}
+	return caso
+}
+
+func TestAvailablePuzzles(t *testing.T) {
+	caso := graphCase()
+	tests := []struct {
+		solved []int
+		want   []int
+	}{
+		{nil, []int{1}},
+		{[]int{1}, []int{2, 3}},
+		{[]int{1, 3}, []int{2}},
+		{[]int{1, 2, 3}, []int{}},
+	}
+
+	for _, tt := range tests {
+		prog := &models.Progression{StoryState: models.StoryState{Solved: tt.solved}}
+		if got := availablePuzzles(caso, prog); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("availablePuzzles(solved=%v) = %v, quer %v", tt.solved, got, tt.want)
+		}
+	}
+
+	if usesPuzzleGraph(testCase()) {
+		t.Error("caso sem prerequisites nem ending deveria ser linear")
+	}
+	if !usesPuzzleGraph(caso) {
+		t.Error("caso com prerequisites deveria usar o grafo")
+	}
+}
+
+func TestPuzzleCommand(t *testing.T) {
+	g := newTestGame(t, graphCase())
+
+	tests := []struct {
+		command string
+		success bool
+		puzzle  int
+	}{
+		{"PUZZLE 2", false, 1},
+		{"UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'", true, 2},
+		{"PUZZLES", true, 2},
+		{"PUZZLES 3", false, 2},
+		{"PUZZLE", true, 2},
+		{"PUZZLE 2", false, 2},
+		{"PUZZLE 1", false, 2},
+		{"PUZZLE 4", false, 2},
+		{"PUZZLE três", false, 2},
+		{"PUZZLE 3", true, 3},
+		{"BEGIN", true, 3},
+		{"PUZZLE 2", false, 3},
+		{"ROLLBACK", true, 3},
+		{"PUZZLE 2", true, 2},
+	}
+
+	for _, tt := range tests {
+		resp := g.run(tt.command)
+		if resp.Success != tt.success {
+			t.Fatalf("%s: Success = %v, quer %v (%s)", tt.command, resp.Success, tt.success, resp.Error)
+		}
+		if !tt.success && resp.ErrorCode != models.ErrPuzzleUnavailable && resp.ErrorCode != models.ErrTransactionState {
+			t.Errorf("%s: ErrorCode = %s", tt.command, resp.ErrorCode)
+		}
+		if g.prog.CurrentPuzzle != tt.puzzle {
+			t.Fatalf("%s: puzzle %d, quer %d", tt.command, g.prog.CurrentPuzzle, tt.puzzle)
+		}
+	}
+
+	if !reflect.DeepEqual(g.prog.Solved, []int{1}) {
+		t.Errorf("Solved = %v", g.prog.Solved)
+	}
+	if resp := g.run("PUZZLES"); resp.State.Available == nil || !reflect.DeepEqual(resp.State.Available, []int{2, 3}) {
+		t.Errorf("Available = %v", resp.State.Available)
+	}
+}
+
+func TestPuzzleGraphEnding(t *testing.T) {
+	g := newTestGame(t, graphCase())
+	g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'")
+
+	if resp := g.mustRun("RESOLVER"); resp.Ending != nil || g.prog.CurrentPuzzle != 3 {
+		t.Fatalf("resolver o 2 deveria levar ao 3, não a %d (final %v)", g.prog.CurrentPuzzle, resp.Ending)
+	}
+
+	resp := g.mustRun("RESOLVER")
+	if resp.Ending == nil || resp.Ending.ID != "bom" {
+		t.Fatalf("Ending = %+v, quer bom", resp.Ending)
+	}
+	if !g.prog.Completed || g.prog.CompletedAt == nil || g.prog.Ending != "bom" || g.prog.CurrentPuzzle != 4 {
+		t.Errorf("progressão não encerrada: %+v", g.prog)
+	}
+	if want := "Resolvido.\n\nO caso está encerrado."; resp.Narrative != want {
+		t.Errorf("Narrative = %q, quer %q", resp.Narrative, want)
+	}
+}
+
+func TestLinearCaseRejectsPuzzleCommand(t *testing.T) {
+	g := newTestGame(t, testCase())
+	resp := g.run("PUZZLE 2")
+	if resp.Success || resp.ErrorCode != models.ErrPuzzleUnavailable {
+		t.Fatalf("PUZZLE num caso linear: %+v", resp)
+	}
+}
+
+func TestPuzzleCheckpoints(t *testing.T) {
+	g := newTestGame(t, graphCase())
+	g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'")
+	g.mustRun("INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'p2')")
+	g.mustRun("PUZZLE 3")
+	g.mustRun("INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'p3a')")
+	g.mustRun("INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'p3b')")
+	g.mustRun("PUZZLE 2")
+
+	want := map[string]int{"1": 0, "2": 1, "3": 2}
+	if !reflect.DeepEqual(g.prog.PuzzleCheckpoints, want) {
+		t.Fatalf("PuzzleCheckpoints = %v, quer %v", g.prog.PuzzleCheckpoints, want)
+	}
+
+	// o trecho depois do checkpoint do 2 tem comandos do 3
+	resp := g.run("RESET PUZZLE")
+	if resp.Success || resp.ErrorCode != models.ErrResetUnavailable {
+		t.Fatalf("RESET PUZZLE com outro puzzle depois do checkpoint: %+v", resp)
+	}
+	if len(g.prog.SQLHistory) != 4 {
+		t.Fatalf("histórico com %d itens, quer 4", len(g.prog.SQLHistory))
+	}
+
+	g.mustRun("PUZZLE 3")
+	g.mustRun("RESET PUZZLE")
+	if len(g.prog.SQLHistory) != 2 {
+		t.Fatalf("RESET PUZZLE no 3 deixou %d itens, quer 2", len(g.prog.SQLHistory))
+	}
+	got := g.column("SELECT descricao FROM pistas ORDER BY id")
+	if want := []interface{}{"cabelo", "pegada", "p2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pistas = %v, quer %v", got, want)
+	}
+}
+
+func TestRepairOptionsSkipOtherPuzzles(t *testing.T) {
+	prog := &models.Progression{
+		CurrentPuzzle:     2,
+		PuzzleCheckpoints: map[string]int{"1": 0, "2": 1, "3": 2},
+		SQLHistory: []models.SQLHistoryItem{
+			{PuzzleState: 1}, {PuzzleState: 2}, {PuzzleState: 3}, {PuzzleState: 2},
+		},
+		Diverged:   true,
+		Divergence: &models.Divergence{Index: 3},
+	}
+	p := NewGameProcessor(nil)
+
+	if got := p.RepairOptions(prog); !reflect.DeepEqual(got, []string{models.RepairLastGood}) {
+		t.Errorf("RepairOptions = %v, quer só %s", got, models.RepairLastGood)
+	}
+
+	prog.CurrentPuzzle = 3
+	want := []string{models.RepairLastGood, models.RepairPuzzleCheckpoint}
+	prog.SQLHistory[3].PuzzleState = 3
+	if got := p.RepairOptions(prog); !reflect.DeepEqual(got, want) {
+		t.Errorf("RepairOptions = %v, quer %v", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"strings"
+)
+
+var defaultAllowedStatements = []string{
+	string(StmtSelect),
+	string(StmtInsert),
+	string(StmtUpdate),
+	string(StmtDelete),
+}
+
+func findPuzzle(caso *models.Case, number int) *models.Puzzle {
+	for i := range caso.Puzzles {
+		if caso.Puzzles[i].Number == number {
+			return &caso.Puzzles[i]
+		}
+	}
+	return nil
+}
+
+func allowedStatements(puzzle *models.Puzzle) []string {
+	if puzzle == nil || len(puzzle.AllowedStatements) == 0 {
+		return defaultAllowedStatements
+	}
+	return puzzle.AllowedStatements
+}
+
+// statementAllowed compara o tipo classificado com a lista do autor. SELECT
+// cobre todos os comandos somente leitura (VALUES, EXPLAIN, PRAGMA de leitura).
+func statementAllowed(puzzle *models.Puzzle, stmt SQLStatement) bool {
+	for _, allowed := range allowedStatements(puzzle) {
+		kind := StatementKind(strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(allowed), "_", " ")))
+		if kind == stmt.Kind || (kind == StmtSelect && stmt.ReadOnly) {
+			return true
+		}
+	}
+	return false
+}
+
+func puzzleRestrictions(puzzle *models.Puzzle) db.PolicyRestrictions {
+	r := db.PolicyRestrictions{}
+	if puzzle == nil {
+		return r
+	}
+	r.AllowedTables = puzzle.AllowedTables
+	r.AllowIndexes = statementAllowed(puzzle, SQLStatement{Kind: StmtCreateIndex})
+	r.AllowViews = statementAllowed(puzzle, SQLStatement{Kind: StmtCreateView})
+	return r
+}
+
+func statementDeniedMessage(puzzle *models.Puzzle, stmt SQLStatement) string {
+	if puzzle != nil && puzzle.StatementDeniedMessage != "" {
+		return puzzle.StatementDeniedMessage
+	}
+	return "Você hesita antes de executar o " + string(stmt.Kind) + ". Este não é o momento para esse tipo de comando; foque no que a investigação pede agora."
+}
+
+func tableDeniedMessage(puzzle *models.Puzzle, table string) string {
+	if puzzle != nil && puzzle.TableDeniedMessage != "" {
+		return puzzle.TableDeniedMessage
+	}
+	return "Você ainda não tem acesso à tabela " + table + ". Talvez ela se torne relevante mais adiante na investigação."
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	typeInteger = "INTEGER"
+	typeReal    = "REAL"
+	typeText    = "TEXT"
+	typeBlob    = "BLOB"
+	typeNull    = "NULL"
+	typeMixed   = "MIXED"
+)
+
+func (p *GameProcessor) serializeRows(rows *sql.Rows) (models.QueryResult, error) {
+	limits := p.SQLiteFactory.Limits
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return models.QueryResult{}, err
+	}
+
+	result := models.QueryResult{
+		Columns:     cols,
+		ColumnTypes: make([]models.ColumnType, len(cols)),
+		Rows:        make([][]interface{}, 0),
+	}
+
+	colTypes, err := rows.ColumnTypes()
+	for i, name := range cols {
+		result.ColumnTypes[i] = models.ColumnType{Name: name, RuntimeType: typeNull}
+		if err == nil && i < len(colTypes) {
+			result.ColumnTypes[i].DeclaredType = strings.ToUpper(colTypes[i].DatabaseTypeName())
+		}
+	}
+
+	for rows.Next() {
+		if limits.MaxRows > 0 && len(result.Rows) >= limits.MaxRows {
+			result.Truncated = true
+			break
+		}
+
+		values := make([]interface{}, len(cols))
+		pointers := make([]interface{}, len(cols))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return result, err
+		}
+
+		row := make([]interface{}, len(cols))
+		for i, v := range values {
+			mergeRuntimeType(&result.ColumnTypes[i], runtimeType(v))
+
+			cell, cut := truncateCell(renderCell(v), limits.MaxCellBytes)
+			if cut {
+				result.Truncated = true
+			}
+			row[i] = cell
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	result.RowCount = len(result.Rows)
+	return result, nil
+}
+
+func runtimeType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return typeNull
+	case int64, int, int32, bool:
+		return typeInteger
+	case float64, float32:
+		return typeReal
+	case []byte:
+		return typeBlob
+	default:
+		return typeText
+	}
+}
+
+// mergeRuntimeType ignora NULLs e marca a coluna como MIXED quando valores
+// de classes de armazenamento diferentes aparecem nela.
+func mergeRuntimeType(col *models.ColumnType, t string) {
+	switch {
+	case t == typeNull || col.RuntimeType == t || col.RuntimeType == typeMixed:
+	case col.RuntimeType == typeNull:
+		col.RuntimeType = t
+	default:
+		col.RuntimeType = typeMixed
+	}
+}
+
+func renderCell(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return "X'" + strings.ToUpper(hex.EncodeToString(b)) + "'"
+	}
+	return v
+}
+
+func truncateCell(value interface{}, maxBytes int) (interface{}, bool) {
+	if maxBytes <= 0 {
+		return value, false
+	}
+	if v, ok := value.(string); ok && len(v) > maxBytes {
+		return strings.ToValidUTF8(v[:maxBytes], "") + "…", true
+	}
+	return value, false
+}
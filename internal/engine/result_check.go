@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"context"
+	"math"
+	"strings"
+	"time"
+)
+
+const validationResultCheck = "result_check"
+
+// resultComparison registra onde o resultado do jogador diverge da
+// referência; é a base tanto da aprovação quanto do feedback parcial.
+type resultComparison struct {
+	truncated      bool
+	columnsOK      bool
+	playerColumns  int
+	expectColumns  int
+	missingColumns []string
+	extraColumns   []string
+	playerRows     int
+	expectRows     int
+	unmatchedRows  int
+	missingRows    int
+	orderMismatch  bool
+}
+
+func (c resultComparison) matches() bool {
+	return !c.truncated && c.columnsOK && c.unmatchedRows == 0 && c.missingRows == 0 && !c.orderMismatch
+}
+
+// matchesReference executa a ReferenceSQL da validação no banco do jogador e
+// compara o resultado com o SELECT que ele acabou de rodar.
+func (p *GameProcessor) matchesReference(ctx context.Context, dbInstance *db.Sandbox, player models.QueryResult, v models.Validation, now time.Time) (bool, *models.ResultFeedback) {
+	var reference models.QueryResult
+	err := dbInstance.Trusted(func() error {
+		rows, err := dbInstance.QueryContext(ctx, applyWorldClock(v.ReferenceSQL, now))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		reference, err = p.serializeRows(rows)
+		return err
+	})
+	if err != nil || reference.Truncated {
+		return false, nil
+	}
+
+	cmp := compareResults(player, reference, v)
+	if cmp.matches() {
+		return true, nil
+	}
+	return false, buildFeedback(cmp, v.FeedbackLevel)
+}
+
+func compareResults(player, reference models.QueryResult, v models.Validation) resultComparison {
+	cmp := resultComparison{
+		truncated:     player.Truncated,
+		playerColumns: len(player.Columns),
+		expectColumns: len(reference.Columns),
+		playerRows:    len(player.Rows),
+		expectRows:    len(reference.Rows),
+	}
+
+	mapping := columnMapping(&cmp, player.Columns, reference.Columns, v.IgnoreColumnNames)
+	if !cmp.columnsOK {
+		return cmp
+	}
+
+	rows := make([][]interface{}, len(player.Rows))
+	for i, row := range player.Rows {
+		rows[i] = make([]interface{}, len(mapping))
+		for j, src := range mapping {
+			rows[i][j] = row[src]
+		}
+	}
+
+	// cada linha de referência consome uma linha igual do jogador
+	used := make([]bool, len(rows))
+	for _, ref := range reference.Rows {
+		found := false
+		for i, row := range rows {
+			if !used[i] && rowsEqual(row, ref, v.NumericTolerance) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			cmp.missingRows++
+		}
+	}
+	for _, u := range used {
+		if !u {
+			cmp.unmatchedRows++
+		}
+	}
+
+	if v.OrderSensitive && cmp.missingRows == 0 && cmp.unmatchedRows == 0 {
+		for i := range rows {
+			if !rowsEqual(rows[i], reference.Rows[i], v.NumericTolerance) {
+				cmp.orderMismatch = true
+				break
+			}
+		}
+	}
+
+	return cmp
+}
+
+// columnMapping devolve, para cada coluna da referência, a posição da coluna
+// correspondente no resultado do jogador: pela posição quando os nomes são
+// ignorados, ou pelo nome (sem diferenciar maiúsculas) em qualquer ordem.
+func columnMapping(cmp *resultComparison, player, reference []string, ignoreNames bool) []int {
+	mapping := make([]int, len(reference))
+
+	if ignoreNames {
+		cmp.columnsOK = len(player) == len(reference)
+		for i := range reference {
+			mapping[i] = i
+		}
+		return mapping
+	}
+
+	used := make([]bool, len(player))
+	for i, name := range reference {
+		mapping[i] = -1
+		for j, col := range player {
+			if !used[j] && strings.EqualFold(col, name) {
+				mapping[i] = j
+				used[j] = true
+				break
+			}
+		}
+		if mapping[i] < 0 {
+			cmp.missingColumns = append(cmp.missingColumns, name)
+		}
+	}
+	for j, col := range player {
+		if !used[j] {
+			cmp.extraColumns = append(cmp.extraColumns, col)
+		}
+	}
+
+	cmp.columnsOK = len(cmp.missingColumns) == 0 && len(cmp.extraColumns) == 0
+	return mapping
+}
+
+func rowsEqual(a, b []interface{}, tolerance float64) bool {
+	for i := range a {
+		if !cellsEqual(a[i], b[i], tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+func cellsEqual(a, b interface{}, tolerance float64) bool {
+	fa, aNum := numericValue(a)
+	fb, bNum := numericValue(b)
+	if aNum && bNum {
+		return math.Abs(fa-fb) <= tolerance
+	}
+	return a == b
+}
+
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"testing"
+)
+
+func TestCompareResults(t *testing.T) {
+	reference := models.QueryResult{
+		Columns: []string{"nome", "total"},
+		Rows:    [][]interface{}{{"Ana", int64(2)}, {"Bruno", 1.5}},
+	}
+
+	tests := []struct {
+		name   string
+		player models.QueryResult
+		v      models.Validation
+		want   bool
+	}{
+		{"igual", reference, models.Validation{}, true},
+		{
+			"outra ordem",
+			models.QueryResult{Columns: []string{"nome", "total"}, Rows: [][]interface{}{{"Bruno", 1.5}, {"Ana", int64(2)}}},
+			models.Validation{}, true,
+		},
+		{
+			"ordem exigida",
+			models.QueryResult{Columns: []string{"nome", "total"}, Rows: [][]interface{}{{"Bruno", 1.5}, {"Ana", int64(2)}}},
+			models.Validation{OrderSensitive: true}, false,
+		},
+		{
+			"colunas em outra ordem",
+			models.QueryResult{Columns: []string{"TOTAL", "Nome"}, Rows: [][]interface{}{{int64(2), "Ana"}, {1.5, "Bruno"}}},
+			models.Validation{}, true,
+		},
+		{
+			"alias diferente",
+			models.QueryResult{Columns: []string{"n", "t"}, Rows: reference.Rows},
+			models.Validation{}, false,
+		},
+		{
+			"alias ignorado",
+			models.QueryResult{Columns: []string{"n", "t"}, Rows: reference.Rows},
+			models.Validation{IgnoreColumnNames: true}, true,
+		},
+		{
+			"tolerância",
+			models.QueryResult{Columns: []string{"nome", "total"}, Rows: [][]interface{}{{"Ana", 2.001}, {"Bruno", int64(1)}}},
+			models.Validation{NumericTolerance: 0.5}, true,
+		},
+		{
+			"linha a mais",
+			models.QueryResult{Columns: []string{"nome", "total"}, Rows: append(reference.Rows, []interface{}{"Carla", int64(0)})},
+			models.Validation{}, false,
+		},
+		{
+			"truncado",
+			models.QueryResult{Columns: reference.Columns, Rows: reference.Rows, Truncated: true},
+			models.Validation{}, false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareResults(tt.player, reference, tt.v).matches(); got != tt.want {
+				t.Errorf("matches = %v, quer %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultCheck(t *testing.T) {
+	caso := testCase()
+	caso.Validations = []models.Validation{{
+		Puzzle:           1,
+		Type:             validationResultCheck,
+		ReferenceSQL:     "SELECT nome FROM suspeitos WHERE cargo = 'Chefe'",
+		SuccessNarrative: "Achou o chefe.",
+		FailureNarrative: "Não é esse.",
+		FeedbackLevel:    feedbackFull,
+		UnlocksNext:      true,
+		NextPuzzle:       2,
+	}}
+	g := newTestGame(t, caso)
+
+	// um UPDATE não é comparado à referência
+	if resp := g.mustRun("UPDATE suspeitos SET cargo = 'Chefe' WHERE id = 3"); resp.Narrative == "Não é esse." || resp.Feedback != nil {
+		t.Errorf("UPDATE comparado à referência: %q", resp.Narrative)
+	}
+
+	resp := g.mustRun("SELECT nome FROM suspeitos WHERE id = 2")
+	if resp.Narrative != "Não é esse." || resp.Feedback == nil || resp.Feedback.MissingRows != 1 {
+		t.Errorf("resposta = %q, feedback %+v", resp.Narrative, resp.Feedback)
+	}
+
+	resp = g.mustRun("SELECT nome FROM suspeitos WHERE cargo = 'Chefe'")
+	if resp.Narrative != "Achou o chefe." || g.prog.CurrentPuzzle != 2 {
+		t.Errorf("resposta = %q no puzzle %d", resp.Narrative, g.prog.CurrentPuzzle)
+	}
+}
+
+func TestResultCheckWithoutReference(t *testing.T) {
+	caso := testCase()
+	caso.Validations[0].Type = validationResultCheck
+	g := newTestGame(t, caso)
+
+	resp := g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'")
+	if resp.Narrative != "Bruno foi preso." || g.prog.CurrentPuzzle != 2 {
+		t.Errorf("result_check sem reference_sql deveria usar check_sql: %q no puzzle %d", resp.Narrative, g.prog.CurrentPuzzle)
+	}
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"strings"
+)
+
+// Níveis de feedback de uma validação result_check, do mais discreto ao mais
+// revelador. Cada nível inclui o anterior.
+const (
+	feedbackNone    = "none"
+	feedbackRows    = "rows"
+	feedbackColumns = "columns"
+	feedbackFull    = "full"
+)
+
+var feedbackRank = map[string]int{
+	"":              0,
+	feedbackNone:    0,
+	feedbackRows:    1,
+	feedbackColumns: 2,
+	feedbackFull:    3,
+}
+
+func buildFeedback(cmp resultComparison, level string) *models.ResultFeedback {
+	rank := feedbackRank[strings.ToLower(level)]
+	if rank == 0 {
+		return nil
+	}
+
+	fb := &models.ResultFeedback{Messages: make([]string, 0)}
+
+	if cmp.truncated {
+		fb.Messages = append(fb.Messages, fmt.Sprintf("Seu resultado passou do limite de linhas do terminal; o esperado tem %d linha(s).", cmp.expectRows))
+		return fb
+	}
+
+	if rank >= feedbackRank[feedbackColumns] {
+		switch {
+		case len(cmp.missingColumns) > 0 || len(cmp.extraColumns) > 0:
+			fb.MissingColumns = cmp.missingColumns
+			fb.ExtraColumns = cmp.extraColumns
+			for _, col := range cmp.missingColumns {
+				fb.Messages = append(fb.Messages, fmt.Sprintf("A coluna %s está faltando.", col))
+			}
+			for _, col := range cmp.extraColumns {
+				fb.Messages = append(fb.Messages, fmt.Sprintf("A coluna %s não era esperada.", col))
+			}
+		case !cmp.columnsOK:
+			fb.Messages = append(fb.Messages, fmt.Sprintf("Sua consulta devolve %d coluna(s), mas eram esperadas %d.", cmp.playerColumns, cmp.expectColumns))
+		}
+	}
+
+	if rank >= feedbackRank[feedbackFull] && cmp.columnsOK {
+		fb.ExtraRows = cmp.unmatchedRows
+		fb.MissingRows = cmp.missingRows
+		fb.OrderMismatch = cmp.orderMismatch
+
+		switch {
+		case cmp.orderMismatch:
+			fb.Messages = append(fb.Messages, "Suas linhas estão corretas, mas a ordem não.")
+		case cmp.unmatchedRows > 0 && cmp.unmatchedRows == cmp.missingRows:
+			fb.Messages = append(fb.Messages, fmt.Sprintf("%d linha(s) do seu resultado não batem com o esperado.", cmp.unmatchedRows))
+		default:
+			if cmp.unmatchedRows > 0 {
+				fb.Messages = append(fb.Messages, fmt.Sprintf("Você retornou %d linha(s) que não deveriam estar no resultado.", cmp.unmatchedRows))
+			}
+			if cmp.missingRows > 0 {
+				fb.Messages = append(fb.Messages, fmt.Sprintf("Faltam %d linha(s) no seu resultado.", cmp.missingRows))
+			}
+		}
+		return fb
+	}
+
+	diff := cmp.playerRows - cmp.expectRows
+	switch {
+	case diff > 0:
+		fb.ExtraRows = diff
+		fb.Messages = append(fb.Messages, fmt.Sprintf("Você retornou %d linha(s) a mais do que o esperado.", diff))
+	case diff < 0:
+		fb.MissingRows = -diff
+		fb.Messages = append(fb.Messages, fmt.Sprintf("Você retornou %d linha(s) a menos do que o esperado.", -diff))
+	case len(fb.Messages) == 0:
+		fb.Messages = append(fb.Messages, "O número de linhas confere, mas algo no resultado ainda não.")
+	}
+
+	return fb
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// startPuzzleClock marca a primeira vez que o jogador entrou no puzzle.
+func startPuzzleClock(prog *models.Progression, puzzle int) {
+	if prog.PuzzleStats == nil {
+		prog.PuzzleStats = map[string]models.PuzzleStats{}
+	}
+	// as tentativas com erro podem ter criado a entrada sem StartedAt
+	key := strconv.Itoa(puzzle)
+	if stats := prog.PuzzleStats[key]; stats.StartedAt.IsZero() {
+		stats.StartedAt = time.Now()
+		prog.PuzzleStats[key] = stats
+	}
+}
+
+func stopPuzzleClock(prog *models.Progression, puzzle int) {
+	startPuzzleClock(prog, puzzle)
+	key := strconv.Itoa(puzzle)
+	stats := prog.PuzzleStats[key]
+	if stats.SolvedAt == nil {
+		now := time.Now()
+		stats.SolvedAt = &now
+		prog.PuzzleStats[key] = stats
+	}
+}
+
+// completeCase encerra o caso; CompletedAt é o sinal para o handler gravar
+// a pontuação.
+func completeCase(prog *models.Progression) {
+	prog.Completed = true
+	if prog.CompletedAt == nil {
+		now := time.Now()
+		prog.CompletedAt = &now
+	}
+}
+
+func scoringFor(caso *models.Case) models.ScoringConfig {
+	if caso.Config.Scoring != nil {
+		return *caso.Config.Scoring
+	}
+	return models.DefaultScoring()
+}
+
+// ComputeScore calcula a pontuação de uma progressão encerrada: os pontos
+// de cada puzzle resolvido, que nunca ficam negativos, mais o bônus do
+// final.
+func ComputeScore(caso *models.Case, prog *models.Progression) *models.Score {
+	cfg := scoringFor(caso)
+
+	completedAt := time.Now()
+	if prog.CompletedAt != nil {
+		completedAt = *prog.CompletedAt
+	}
+
+	solved := append([]int(nil), prog.Solved...)
+	sort.Ints(solved)
+
+	score := &models.Score{
+		UserID:      prog.UserID,
+		CaseID:      prog.CaseID,
+		Puzzles:     make([]models.PuzzleScore, 0, len(solved)),
+		Ending:      prog.Ending,
+		Outcome:     prog.Outcome,
+		CompletedAt: completedAt,
+	}
+	if !prog.CreatedAt.IsZero() {
+		score.ElapsedSeconds = int64(completedAt.Sub(prog.CreatedAt).Seconds())
+	}
+
+	for _, n := range solved {
+		ps := models.PuzzleScore{Puzzle: n}
+		stats := prog.PuzzleStats[strconv.Itoa(n)]
+		ps.FailedAttempts = stats.FailedAttempts
+
+		for _, h := range prog.HintsUsed {
+			if h.Puzzle != n {
+				continue
+			}
+			ps.HintsUsed++
+			ps.HintPenalty += h.Penalty
+		}
+
+		if !stats.StartedAt.IsZero() && stats.SolvedAt != nil {
+			elapsed := stats.SolvedAt.Sub(stats.StartedAt)
+			ps.ElapsedSeconds = int64(elapsed.Seconds())
+			if over := elapsed - time.Duration(cfg.ParMinutes)*time.Minute; over > 0 {
+				// minuto começado conta como minuto inteiro
+				minutes := int((over + time.Minute - 1) / time.Minute)
+				ps.TimePenalty = minutes * cfg.MinutePenalty
+			}
+		}
+
+		ps.Points = max(cfg.PuzzlePoints-ps.FailedAttempts*cfg.FailedAttemptPenalty-ps.HintPenalty-ps.TimePenalty, 0)
+		score.Puzzles = append(score.Puzzles, ps)
+		score.Total += ps.Points
+	}
+
+	if bonus, ok := cfg.EndingBonus[prog.Ending]; ok && prog.Ending != "" {
+		score.EndingBonus = bonus
+	} else if bonus, ok := cfg.EndingBonus[prog.Outcome]; ok && prog.Outcome != "" {
+		score.EndingBonus = bonus
+	}
+	score.Total += score.EndingBonus
+
+	return score
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeScore(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes, seconds int) *time.Time {
+		t := start.Add(time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second)
+		return &t
+	}
+
+	tests := []struct {
+		name   string
+		prog   models.Progression
+		points []int
+		bonus  int
+	}{
+		{
+			"sem descontos",
+			models.Progression{
+				StoryState:  models.StoryState{Solved: []int{1}},
+				PuzzleStats: map[string]models.PuzzleStats{"1": {StartedAt: start, SolvedAt: at(5, 0)}},
+			},
+			[]int{100}, 0,
+		},
+		{
+			"tentativas e dicas",
+			models.Progression{
+				StoryState:  models.StoryState{Solved: []int{1}},
+				PuzzleStats: map[string]models.PuzzleStats{"1": {StartedAt: start, SolvedAt: at(1, 0), FailedAttempts: 2}},
+				HintsUsed:   []models.HintUse{{Puzzle: 1, Penalty: 10}, {Puzzle: 1, Penalty: 25}, {Puzzle: 2, Penalty: 40}},
+			},
+			[]int{55}, 0,
+		},
+		{
+			"minuto começado conta inteiro",
+			models.Progression{
+				StoryState:  models.StoryState{Solved: []int{1}},
+				PuzzleStats: map[string]models.PuzzleStats{"1": {StartedAt: start, SolvedAt: at(12, 1)}},
+			},
+			[]int{97}, 0,
+		},
+		{
+			"nunca negativo",
+			models.Progression{
+				StoryState:  models.StoryState{Solved: []int{2, 1}},
+				PuzzleStats: map[string]models.PuzzleStats{"1": {FailedAttempts: 30}},
+			},
+			[]int{0, 100}, 0,
+		},
+		{
+			"bônus pelo final",
+			models.Progression{StoryState: models.StoryState{Solved: []int{1}}, Ending: "bom", Outcome: models.OutcomeWrong},
+			[]int{100}, 300,
+		},
+		{
+			"bônus pelo resultado",
+			models.Progression{StoryState: models.StoryState{Solved: []int{1}}, Ending: "outro", Outcome: models.OutcomePartial},
+			[]int{100}, 100,
+		},
+	}
+
+	caso := testCase()
+	scoring := models.DefaultScoring()
+	scoring.EndingBonus["bom"] = 300
+	caso.Config.Scoring = &scoring
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prog.CreatedAt = start
+			tt.prog.CompletedAt = at(30, 0)
+			score := ComputeScore(caso, &tt.prog)
+
+			if len(score.Puzzles) != len(tt.points) {
+				t.Fatalf("%d puzzles pontuados, quer %d", len(score.Puzzles), len(tt.points))
+			}
+			total := tt.bonus
+			for i, want := range tt.points {
+				if score.Puzzles[i].Points != want {
+					t.Errorf("puzzle %d: %+v, quer %d pontos", score.Puzzles[i].Puzzle, score.Puzzles[i], want)
+				}
+				total += want
+			}
+			if score.EndingBonus != tt.bonus || score.Total != total {
+				t.Errorf("bônus %d e total %d, quer %d e %d", score.EndingBonus, score.Total, tt.bonus, total)
+			}
+			if score.ElapsedSeconds != 1800 {
+				t.Errorf("ElapsedSeconds = %d, quer 1800", score.ElapsedSeconds)
+			}
+		})
+	}
+}
+
+// o desconto mostrado na dica é o mesmo gravado e cobrado na pontuação
+func TestHintPenalty(t *testing.T) {
+	caso := testCase()
+	caso.Puzzles[0].Hints = []models.Hint{{Text: "Olhe os cargos."}, {Text: "É o chefe.", Penalty: 30}}
+	g := newTestGame(t, caso)
+
+	tests := []struct {
+		penalty int
+		new     bool
+	}{
+		{10, true},
+		{30, true},
+		{0, false},
+	}
+
+	for i, tt := range tests {
+		resp := g.mustRun("DICA")
+		if resp.Hint.Penalty != tt.penalty || resp.Hint.New != tt.new {
+			t.Errorf("dica %d: Hint = %+v, quer desconto %d", i+1, resp.Hint, tt.penalty)
+		}
+		if tt.penalty > 0 && !strings.Contains(resp.Narrative, "-"+strconv.Itoa(tt.penalty)+" pontos") {
+			t.Errorf("dica %d: Narrative = %q", i+1, resp.Narrative)
+		}
+	}
+
+	if len(g.prog.HintsUsed) != 2 || g.prog.HintsUsed[0].Penalty != 10 {
+		t.Fatalf("HintsUsed = %+v", g.prog.HintsUsed)
+	}
+
+	g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'")
+	g.prog.Solved = []int{1}
+	if ps := ComputeScore(caso, g.prog).Puzzles[0]; ps.HintPenalty != 40 {
+		t.Errorf("HintPenalty = %d, quer 40", ps.HintPenalty)
+	}
+}
@@ -0,0 +1,392 @@
+package engine
+
+import "casos-de-codigo-api/internal/db"
+
+type StatementKind string
+
+const (
+	StmtUnknown       StatementKind = "UNKNOWN"
+	StmtSelect        StatementKind = "SELECT"
+	StmtValues        StatementKind = "VALUES"
+	StmtExplain       StatementKind = "EXPLAIN"
+	StmtInsert        StatementKind = "INSERT"
+	StmtUpdate        StatementKind = "UPDATE"
+	StmtDelete        StatementKind = "DELETE"
+	StmtCreateTable   StatementKind = "CREATE TABLE"
+	StmtCreateIndex   StatementKind = "CREATE INDEX"
+	StmtCreateView    StatementKind = "CREATE VIEW"
+	StmtCreateTrigger StatementKind = "CREATE TRIGGER"
+	StmtDrop          StatementKind = "DROP"
+	StmtAlter         StatementKind = "ALTER"
+	StmtPragma        StatementKind = "PRAGMA"
+	StmtAttach        StatementKind = "ATTACH"
+	StmtDetach        StatementKind = "DETACH"
+	StmtBegin         StatementKind = "BEGIN"
+	StmtCommit        StatementKind = "COMMIT"
+	StmtRollback      StatementKind = "ROLLBACK"
+	StmtSavepoint     StatementKind = "SAVEPOINT"
+	StmtRelease       StatementKind = "RELEASE"
+	StmtVacuum        StatementKind = "VACUUM"
+	StmtAnalyze       StatementKind = "ANALYZE"
+	StmtReindex       StatementKind = "REINDEX"
+)
+
+type SQLStatement struct {
+	Kind     StatementKind
+	Tables   []string
+	ReadOnly bool
+}
+
+func (s SQLStatement) IsSQL() bool {
+	return s.Kind != StmtUnknown
+}
+
+func (s SQLStatement) IsDML() bool {
+	return s.Kind == StmtInsert || s.Kind == StmtUpdate || s.Kind == StmtDelete
+}
+
+func ClassifySQL(query string) SQLStatement {
+	return classifyTokens(tokenizeSQL(query))
+}
+
+func classifyTokens(tokens []sqlToken) SQLStatement {
+	stmt := SQLStatement{Kind: StmtUnknown}
+
+	start := 0
+	for start < len(tokens) && tokens[start].isSymbol("(") {
+		start++
+	}
+	if start >= len(tokens) || tokens[start].Kind != tokWord {
+		return stmt
+	}
+
+	body := tokens[start:]
+	stmt.Kind = statementKind(body)
+
+	switch stmt.Kind {
+	case StmtSelect, StmtValues, StmtExplain:
+		stmt.ReadOnly = true
+	case StmtPragma:
+		stmt.ReadOnly = isReadOnlyPragma(body)
+	}
+
+	if stmt.Kind != StmtUnknown {
+		stmt.Tables = referencedTables(body)
+	}
+
+	return stmt
+}
+
+func statementKind(tokens []sqlToken) StatementKind {
+	switch tokens[0].upper() {
+	case "SELECT":
+		return StmtSelect
+	case "VALUES":
+		return StmtValues
+	case "EXPLAIN":
+		return StmtExplain
+	case "INSERT", "REPLACE":
+		return StmtInsert
+	case "UPDATE":
+		return StmtUpdate
+	case "DELETE":
+		return StmtDelete
+	case "WITH":
+		return cteMainKind(tokens)
+	case "CREATE":
+		return createKind(tokens)
+	case "DROP":
+		return StmtDrop
+	case "ALTER":
+		return StmtAlter
+	case "PRAGMA":
+		return StmtPragma
+	case "ATTACH":
+		return StmtAttach
+	case "DETACH":
+		return StmtDetach
+	case "BEGIN":
+		return StmtBegin
+	case "COMMIT", "END":
+		return StmtCommit
+	case "ROLLBACK":
+		return StmtRollback
+	case "SAVEPOINT":
+		return StmtSavepoint
+	case "RELEASE":
+		return StmtRelease
+	case "VACUUM":
+		return StmtVacuum
+	case "ANALYZE":
+		return StmtAnalyze
+	case "REINDEX":
+		return StmtReindex
+	}
+	return StmtUnknown
+}
+
+// cteMainKind procura, fora dos parênteses das CTEs, o comando que de fato
+// consome o WITH.
+func cteMainKind(tokens []sqlToken) StatementKind {
+	depth := 0
+	for _, tok := range tokens[1:] {
+		switch {
+		case tok.isSymbol("("):
+			depth++
+		case tok.isSymbol(")"):
+			depth--
+		case depth == 0 && tok.isWord("SELECT"):
+			return StmtSelect
+		case depth == 0 && tok.isWord("VALUES"):
+			return StmtValues
+		case depth == 0 && tok.isWord("INSERT", "REPLACE"):
+			return StmtInsert
+		case depth == 0 && tok.isWord("UPDATE"):
+			return StmtUpdate
+		case depth == 0 && tok.isWord("DELETE"):
+			return StmtDelete
+		}
+	}
+	return StmtUnknown
+}
+
+func createKind(tokens []sqlToken) StatementKind {
+	for _, tok := range tokens[1:] {
+		switch tok.upper() {
+		case "TEMP", "TEMPORARY", "UNIQUE", "VIRTUAL":
+			continue
+		case "TABLE":
+			return StmtCreateTable
+		case "INDEX":
+			return StmtCreateIndex
+		case "VIEW":
+			return StmtCreateView
+		case "TRIGGER":
+			return StmtCreateTrigger
+		default:
+			return StmtUnknown
+		}
+	}
+	return StmtUnknown
+}
+
+func isReadOnlyPragma(tokens []sqlToken) bool {
+	hasArgument := false
+	for _, tok := range tokens {
+		if tok.isSymbol("=") {
+			hasArgument = true
+		}
+	}
+
+	for i := 1; i < len(tokens); i++ {
+		if !tokens[i].isName() {
+			break
+		}
+		if i+1 < len(tokens) && tokens[i+1].isSymbol(".") {
+			i++
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].isSymbol("(") {
+			hasArgument = true
+		}
+		return db.ReadOnlyPragma(tokens[i].name(), hasArgument)
+	}
+	return false
+}
+
+var tableListTerminators = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "LIMIT": true, "HAVING": true,
+	"JOIN": true, "LEFT": true, "RIGHT": true, "FULL": true, "INNER": true,
+	"CROSS": true, "NATURAL": true, "OUTER": true, "ON": true, "USING": true,
+	"UNION": true, "EXCEPT": true, "INTERSECT": true, "WINDOW": true,
+	"SET": true, "VALUES": true, "SELECT": true, "DEFAULT": true,
+	"RETURNING": true, "INDEXED": true, "NOT": true, "AS": true,
+	"DO": true, "FROM": true,
+}
+
+// referencedTables percorre o SQL (incluindo subconsultas) e coleta os nomes
+// que aparecem em posição de tabela. Nomes definidos por CTEs são descartados.
+func referencedTables(tokens []sqlToken) []string {
+	cteNames := map[string]bool{}
+	for i := 0; i+1 < len(tokens); i++ {
+		if !tokens[i].isName() || tokens[i].isWord("AS") {
+			continue
+		}
+		j := i + 1
+		if tokens[j].isSymbol("(") && isCTEColumnList(tokens, j) {
+			j = skipParens(tokens, j)
+		}
+		if j+1 < len(tokens) && tokens[j].isWord("AS") {
+			k := j + 1
+			for k < len(tokens) && tokens[k].isWord("NOT", "MATERIALIZED") {
+				k++
+			}
+			if k < len(tokens) && tokens[k].isSymbol("(") && precededByCTEStart(tokens, i) {
+				cteNames[tokens[i].name()] = true
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	tables := make([]string, 0)
+	add := func(name string) {
+		if name == "" || cteNames[name] || seen[name] {
+			return
+		}
+		seen[name] = true
+		tables = append(tables, name)
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Kind != tokWord {
+			continue
+		}
+
+		switch tok.upper() {
+		case "FROM":
+			i = collectTableList(tokens, i+1, add)
+		case "JOIN", "INTO":
+			if name, next := readQualifiedName(tokens, i+1); name != "" {
+				add(name)
+				i = next - 1
+			}
+		case "UPDATE":
+			if i > 0 && !tokens[i-1].isSymbol(";", ")") && !tokens[i-1].isWord("BEGIN") {
+				continue
+			}
+			j := i + 1
+			if j < len(tokens) && tokens[j].isWord("OR") {
+				j += 2
+			}
+			if name, next := readQualifiedName(tokens, j); name != "" {
+				add(name)
+				i = next - 1
+			}
+		case "TABLE", "VIEW", "INDEX", "TRIGGER":
+			j := skipIfExists(tokens, i+1)
+			if name, next := readQualifiedName(tokens, j); name != "" {
+				if tok.isWord("TABLE") {
+					add(name)
+				}
+				i = next - 1
+			}
+		case "ON":
+			if isDDLOn(tokens, i) {
+				if name, next := readQualifiedName(tokens, i+1); name != "" {
+					add(name)
+					i = next - 1
+				}
+			}
+		}
+	}
+
+	return tables
+}
+
+func collectTableList(tokens []sqlToken, i int, add func(string)) int {
+	for i < len(tokens) {
+		if tokens[i].isSymbol("(") {
+			// subconsulta: suas tabelas são coletadas pela varredura externa
+			return i - 1
+		}
+
+		name, next := readQualifiedName(tokens, i)
+		if name == "" {
+			return i - 1
+		}
+		if next < len(tokens) && tokens[next].isSymbol("(") {
+			// função de tabela, como pragma_table_info('x')
+			next = skipParens(tokens, next)
+		} else {
+			add(name)
+		}
+		i = next
+
+		if i < len(tokens) && tokens[i].isWord("AS") {
+			i += 2
+		} else if i < len(tokens) && tokens[i].isName() && !tableListTerminators[tokens[i].upper()] {
+			i++
+		}
+
+		if i < len(tokens) && tokens[i].isSymbol(",") {
+			i++
+			continue
+		}
+		return i - 1
+	}
+	return i
+}
+
+func readQualifiedName(tokens []sqlToken, i int) (string, int) {
+	if i >= len(tokens) || !tokens[i].isName() {
+		return "", i
+	}
+	if tokens[i].Kind == tokWord && tableListTerminators[tokens[i].upper()] {
+		return "", i
+	}
+	name := tokens[i].name()
+	i++
+	for i+1 < len(tokens) && tokens[i].isSymbol(".") && tokens[i+1].isName() {
+		name = tokens[i+1].name()
+		i += 2
+	}
+	return name, i
+}
+
+func skipIfExists(tokens []sqlToken, i int) int {
+	if i+1 < len(tokens) && tokens[i].isWord("IF") {
+		i++
+		if tokens[i].isWord("NOT") {
+			i++
+		}
+		if i < len(tokens) && tokens[i].isWord("EXISTS") {
+			i++
+		}
+	}
+	return i
+}
+
+func skipParens(tokens []sqlToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		if tokens[i].isSymbol("(") {
+			depth++
+		} else if tokens[i].isSymbol(")") {
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+func isCTEColumnList(tokens []sqlToken, open int) bool {
+	end := skipParens(tokens, open)
+	return end < len(tokens) && tokens[end].isWord("AS")
+}
+
+func precededByCTEStart(tokens []sqlToken, i int) bool {
+	if i == 0 {
+		return false
+	}
+	prev := tokens[i-1]
+	return prev.isWord("WITH", "RECURSIVE") || prev.isSymbol(",")
+}
+
+// isDDLOn diferencia o ON de CREATE INDEX/TRIGGER do ON de um JOIN.
+func isDDLOn(tokens []sqlToken, i int) bool {
+	if len(tokens) == 0 || !tokens[0].isWord("CREATE") {
+		return false
+	}
+	for j := i - 1; j >= 0; j-- {
+		if tokens[j].isWord("INDEX", "TRIGGER") {
+			return true
+		}
+		if tokens[j].isWord("JOIN", "SELECT", "FROM", "BEGIN") {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifySQL(t *testing.T) {
+	tests := []struct {
+		query    string
+		kind     StatementKind
+		readOnly bool
+		tables   []string
+	}{
+		{"", StmtUnknown, false, nil},
+		{"EXAMINAR mesa", StmtUnknown, false, nil},
+		{"-- só um comentário", StmtUnknown, false, nil},
+
+		{"SELECT * FROM suspeitos", StmtSelect, true, []string{"suspeitos"}},
+		{"select nome from Suspeitos s, \"Álibis\" AS a", StmtSelect, true, []string{"suspeitos", "Álibis"}},
+		{"-- quem estava lá?\nSELECT nome FROM visitas", StmtSelect, true, []string{"visitas"}},
+		{"/* bloco */ SELECT 1", StmtSelect, true, []string{}},
+		{"(SELECT 1) UNION (SELECT 2)", StmtSelect, true, []string{}},
+		{
+			"SELECT s.nome FROM suspeitos s JOIN alibis a ON a.id = s.id LEFT JOIN main.visitas v ON v.id = s.id",
+			StmtSelect, true, []string{"suspeitos", "alibis", "visitas"},
+		},
+		{
+			"SELECT nome FROM suspeitos WHERE id IN (SELECT suspeito_id FROM provas)",
+			StmtSelect, true, []string{"suspeitos", "provas"},
+		},
+		{"SELECT * FROM pragma_table_info('suspeitos')", StmtSelect, true, []string{}},
+
+		{"VALUES (1, 'a'), (2, 'b')", StmtValues, true, []string{}},
+		{"EXPLAIN QUERY PLAN SELECT * FROM provas", StmtExplain, true, []string{"provas"}},
+
+		{
+			"WITH recentes AS (SELECT * FROM visitas WHERE dia > 10) SELECT * FROM recentes",
+			StmtSelect, true, []string{"visitas"},
+		},
+		{
+			"WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 5) SELECT x FROM n",
+			StmtSelect, true, []string{},
+		},
+		{
+			"WITH alvo AS (SELECT id FROM suspeitos) DELETE FROM provas WHERE id IN (SELECT id FROM alvo)",
+			StmtDelete, false, []string{"suspeitos", "provas"},
+		},
+		{"WITH x AS (SELECT 1) VALUES (2)", StmtValues, true, []string{}},
+
+		{"INSERT INTO provas (nome) VALUES ('faca')", StmtInsert, false, []string{"provas"}},
+		{"REPLACE INTO provas VALUES (1)", StmtInsert, false, []string{"provas"}},
+		{"INSERT INTO arquivo SELECT * FROM provas", StmtInsert, false, []string{"arquivo", "provas"}},
+		{"UPDATE suspeitos SET preso = 1 WHERE id = 3", StmtUpdate, false, []string{"suspeitos"}},
+		{"UPDATE OR IGNORE suspeitos SET preso = 1", StmtUpdate, false, []string{"suspeitos"}},
+		{"DELETE FROM provas WHERE id = 1", StmtDelete, false, []string{"provas"}},
+
+		{"CREATE TABLE notas (texto TEXT)", StmtCreateTable, false, []string{"notas"}},
+		{"CREATE TEMP TABLE IF NOT EXISTS notas (texto TEXT)", StmtCreateTable, false, []string{"notas"}},
+		{"CREATE UNIQUE INDEX idx ON suspeitos (nome)", StmtCreateIndex, false, []string{"suspeitos"}},
+		{"CREATE VIEW presos AS SELECT * FROM suspeitos WHERE preso", StmtCreateView, false, []string{"suspeitos"}},
+		{
+			"CREATE TRIGGER log AFTER INSERT ON provas BEGIN INSERT INTO historico VALUES (1); END",
+			StmtCreateTrigger, false, []string{"provas", "historico"},
+		},
+		{"DROP TABLE IF EXISTS notas", StmtDrop, false, []string{"notas"}},
+		{"ALTER TABLE suspeitos ADD COLUMN idade INTEGER", StmtAlter, false, []string{"suspeitos"}},
+
+		{"PRAGMA table_info(suspeitos)", StmtPragma, true, []string{}},
+		{"PRAGMA main.index_list('suspeitos')", StmtPragma, true, []string{}},
+		{"PRAGMA foreign_keys", StmtPragma, true, []string{}},
+		{"PRAGMA foreign_keys = OFF", StmtPragma, false, []string{}},
+		{"PRAGMA writable_schema(1)", StmtPragma, false, []string{}},
+		{"PRAGMA integrity_check", StmtPragma, true, []string{}},
+		{"PRAGMA quick_check(10)", StmtPragma, true, []string{}},
+		{"PRAGMA user_version(7)", StmtPragma, false, []string{}},
+		{"PRAGMA optimize", StmtPragma, false, []string{}},
+		{"PRAGMA shrink_memory", StmtPragma, false, []string{}},
+
+		{"ATTACH 'x.db' AS x", StmtAttach, false, []string{}},
+		{"DETACH x", StmtDetach, false, []string{}},
+		{"BEGIN TRANSACTION", StmtBegin, false, []string{}},
+		{"END", StmtCommit, false, []string{}},
+		{"COMMIT", StmtCommit, false, []string{}},
+		{"ROLLBACK TO sp", StmtRollback, false, []string{}},
+		{"SAVEPOINT sp", StmtSavepoint, false, []string{}},
+		{"RELEASE sp", StmtRelease, false, []string{}},
+		{"VACUUM", StmtVacuum, false, []string{}},
+		{"ANALYZE", StmtAnalyze, false, []string{}},
+		{"REINDEX", StmtReindex, false, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := ClassifySQL(tt.query)
+			if got.Kind != tt.kind {
+				t.Errorf("Kind = %s, quer %s", got.Kind, tt.kind)
+			}
+			if got.ReadOnly != tt.readOnly {
+				t.Errorf("ReadOnly = %v, quer %v", got.ReadOnly, tt.readOnly)
+			}
+			if !reflect.DeepEqual(got.Tables, tt.tables) {
+				t.Errorf("Tables = %#v, quer %#v", got.Tables, tt.tables)
+			}
+			if got.IsSQL() != (tt.kind != StmtUnknown) {
+				t.Errorf("IsSQL() = %v", got.IsSQL())
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var dateFunctions = map[string]bool{
+	"date": true, "time": true, "datetime": true, "julianday": true,
+	"unixepoch": true, "strftime": true, "timediff": true,
+}
+
+var worldTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// worldNow devolve o "agora" do caso. Sem WorldTime declarado, o relógio
+// fica parado no início da progressão: o instante precisa ser o mesmo em
+// toda reexecução do histórico.
+func worldNow(caso *models.Case, progression *models.Progression) time.Time {
+	if caso.Config.WorldTime != "" {
+		for _, layout := range worldTimeLayouts {
+			if t, err := time.Parse(layout, caso.Config.WorldTime); err == nil {
+				return t
+			}
+		}
+		log.Printf("Aviso: world_time inválido no caso %s: %q", caso.ID, caso.Config.WorldTime)
+	}
+	if progression.CreatedAt.IsZero() {
+		progression.CreatedAt = time.Now()
+	}
+	// o Mongo guarda milissegundos; o segundo inteiro sobrevive à gravação
+	return progression.CreatedAt.UTC().Truncate(time.Second)
+}
+
+// applyWorldClock troca 'now', CURRENT_DATE/TIME/TIMESTAMP e as chamadas sem
+// data de date(), time(), strftime() etc. por literais com o horário do
+// caso. Os modificadores 'localtime' e 'utc' viram no-op, já que dependeriam
+// do fuso do servidor.
+func applyWorldClock(query string, now time.Time) string {
+	tokens := tokenizeSQL(query)
+	stamp := fmt.Sprintf("'%s'", now.Format("2006-01-02 15:04:05"))
+
+	type call struct {
+		name string
+		args int
+	}
+
+	edits := make([]sqlEdit, 0)
+	calls := make([]call, 0)
+
+	inDateCall := func() bool {
+		return len(calls) > 0 && dateFunctions[calls[len(calls)-1].name]
+	}
+
+	for i, tok := range tokens {
+		switch {
+		case tok.isSymbol("("):
+			name := ""
+			if i > 0 && tokens[i-1].Kind == tokWord {
+				name = strings.ToLower(tokens[i-1].Text)
+			}
+			empty := i+1 < len(tokens) && tokens[i+1].isSymbol(")")
+			args := 1
+			if empty {
+				args = 0
+			}
+			calls = append(calls, call{name: name, args: args})
+			if dateFunctions[name] && name != "strftime" && empty {
+				edits = append(edits, sqlEdit{Start: tok.End, End: tok.End, Replacement: stamp})
+			}
+
+		case tok.isSymbol(","):
+			if len(calls) > 0 {
+				calls[len(calls)-1].args++
+			}
+
+		case tok.isSymbol(")"):
+			if len(calls) == 0 {
+				continue
+			}
+			// strftime(formato) sem data usa o relógio real
+			if c := calls[len(calls)-1]; c.name == "strftime" && c.args == 1 {
+				edits = append(edits, sqlEdit{Start: tok.Start, End: tok.Start, Replacement: ", " + stamp})
+			}
+			calls = calls[:len(calls)-1]
+
+		case tok.Kind == tokString && inDateCall():
+			switch strings.ToLower(tok.Text) {
+			case "'now'":
+				edits = append(edits, sqlEdit{Start: tok.Start, End: tok.End, Replacement: stamp})
+			case "'localtime'", "'utc'":
+				edits = append(edits, sqlEdit{Start: tok.Start, End: tok.End, Replacement: "'+0 seconds'"})
+			}
+
+		case tok.isWord("CURRENT_TIMESTAMP"):
+			edits = append(edits, sqlEdit{Start: tok.Start, End: tok.End, Replacement: stamp})
+		case tok.isWord("CURRENT_DATE"):
+			edits = append(edits, sqlEdit{Start: tok.Start, End: tok.End, Replacement: fmt.Sprintf("'%s'", now.Format("2006-01-02"))})
+		case tok.isWord("CURRENT_TIME"):
+			edits = append(edits, sqlEdit{Start: tok.Start, End: tok.End, Replacement: fmt.Sprintf("'%s'", now.Format("15:04:05"))})
+		}
+	}
+
+	if len(edits) == 0 {
+		return query
+	}
+	return applyEdits(query, edits)
+}
+
+type clockedCase struct {
+	version   int
+	worldTime string
+	usesClock bool
+	stamp     string
+	caso      *models.Case
+}
+
+// sandboxCase devolve o caso com o schema já ajustado ao relógio da
+// progressão, para que DEFAULT CURRENT_TIMESTAMP e afins também usem o
+// horário da história. Só a última cópia de cada caso fica guardada; um
+// schema que não usa o relógio é devolvido como está.
+func (p *GameProcessor) sandboxCase(caso *models.Case, progression *models.Progression) *models.Case {
+	now := worldNow(caso, progression)
+	stamp := now.Format("2006-01-02 15:04:05")
+
+	if cached, ok := p.clockedCases.Load(caso.ID); ok {
+		entry := cached.(*clockedCase)
+		if entry.version == caso.Version && entry.worldTime == caso.Config.WorldTime {
+			if !entry.usesClock {
+				return caso
+			}
+			if entry.stamp == stamp {
+				return entry.caso
+			}
+		}
+	}
+
+	clocked := *caso
+	clocked.Schemas = make([]models.Schema, len(caso.Schemas))
+	usesClock := false
+	for i, schema := range caso.Schemas {
+		schema.CreateSQL = applyWorldClock(schema.CreateSQL, now)
+		schema.InsertSQL = applyWorldClock(schema.InsertSQL, now)
+		usesClock = usesClock || schema != caso.Schemas[i]
+		clocked.Schemas[i] = schema
+	}
+	clocked.SandboxClock = stamp
+
+	p.clockedCases.Store(caso.ID, &clockedCase{
+		version:   caso.Version,
+		worldTime: caso.Config.WorldTime,
+		usesClock: usesClock,
+		stamp:     stamp,
+		caso:      &clocked,
+	})
+	if !usesClock {
+		return caso
+	}
+	return &clocked
+}
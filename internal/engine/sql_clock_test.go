@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"testing"
+	"time"
+)
+
+func TestApplyWorldClock(t *testing.T) {
+	now := time.Date(2023, 10, 12, 23, 40, 0, 0, time.UTC)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT date('now')", "SELECT date('2023-10-12 23:40:00')"},
+		{"SELECT datetime('NOW', 'localtime')", "SELECT datetime('2023-10-12 23:40:00', '+0 seconds')"},
+		{"SELECT date('now', '-1 day', 'utc')", "SELECT date('2023-10-12 23:40:00', '-1 day', '+0 seconds')"},
+		{"SELECT date(), time(), julianday()", "SELECT date('2023-10-12 23:40:00'), time('2023-10-12 23:40:00'), julianday('2023-10-12 23:40:00')"},
+		{"SELECT CURRENT_TIMESTAMP, CURRENT_DATE, CURRENT_TIME", "SELECT '2023-10-12 23:40:00', '2023-10-12', '23:40:00'"},
+		{"SELECT strftime('%Y-%m-%d')", "SELECT strftime('%Y-%m-%d', '2023-10-12 23:40:00')"},
+		{"SELECT strftime('%H', 'now')", "SELECT strftime('%H', '2023-10-12 23:40:00')"},
+		{"SELECT strftime('%Y', criado_em) FROM t", "SELECT strftime('%Y', criado_em) FROM t"},
+		{"SELECT strftime(upper('%y'))", "SELECT strftime(upper('%y'), '2023-10-12 23:40:00')"},
+		{"SELECT date(criado_em) FROM t WHERE nota = 'now'", "SELECT date(criado_em) FROM t WHERE nota = 'now'"},
+		{"SELECT upper('now')", "SELECT upper('now')"},
+		{
+			"CREATE TABLE t (id INTEGER, criado_em TEXT DEFAULT CURRENT_TIMESTAMP)",
+			"CREATE TABLE t (id INTEGER, criado_em TEXT DEFAULT '2023-10-12 23:40:00')",
+		},
+		{
+			"CREATE TABLE t (dia TEXT DEFAULT (date('now')))",
+			"CREATE TABLE t (dia TEXT DEFAULT (date('2023-10-12 23:40:00')))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := applyWorldClock(tt.query, now); got != tt.want {
+				t.Errorf("applyWorldClock(%q)\n got: %s\nwant: %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorldNow(t *testing.T) {
+	created := time.Date(2024, 3, 1, 9, 30, 15, 250_000_000, time.FixedZone("BRT", -3*3600))
+
+	tests := []struct {
+		name      string
+		worldTime string
+		want      time.Time
+	}{
+		{"world_time", "2023-10-12 23:40:00", time.Date(2023, 10, 12, 23, 40, 0, 0, time.UTC)},
+		{"RFC 3339", "2023-10-12T23:40:00Z", time.Date(2023, 10, 12, 23, 40, 0, 0, time.UTC)},
+		{"só a data", "2023-10-12", time.Date(2023, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{"sem world_time usa o início da progressão", "", time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)},
+		{"world_time inválido", "ontem", time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caso := &models.Case{ID: "c", Config: models.CaseConfig{WorldTime: tt.worldTime}}
+			prog := &models.Progression{CreatedAt: created}
+			if got := worldNow(caso, prog); !got.Equal(tt.want) {
+				t.Errorf("worldNow = %v, quer %v", got, tt.want)
+			}
+		})
+	}
+
+	prog := &models.Progression{}
+	first := worldNow(&models.Case{}, prog)
+	if prog.CreatedAt.IsZero() {
+		t.Fatal("worldNow deveria fixar CreatedAt da progressão nova")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if again := worldNow(&models.Case{}, prog); !again.Equal(first) {
+		t.Errorf("o relógio andou: %v, depois %v", first, again)
+	}
+}
+
+func TestSandboxCase(t *testing.T) {
+	p := NewGameProcessor(db.NewSQLiteFactory())
+	caso := &models.Case{
+		ID:      "c",
+		Version: 1,
+		Schemas: []models.Schema{
+			{Puzzle: 1, CreateSQL: "CREATE TABLE a (id INTEGER)"},
+			{Puzzle: 1, CreateSQL: "CREATE TABLE b (em TEXT DEFAULT CURRENT_TIMESTAMP)"},
+		},
+	}
+	ana := &models.Progression{CreatedAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	bia := &models.Progression{CreatedAt: time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)}
+
+	clocked := p.sandboxCase(caso, ana)
+	if clocked == caso {
+		t.Fatal("schema com CURRENT_TIMESTAMP deveria ser reescrito")
+	}
+	if want := "CREATE TABLE b (em TEXT DEFAULT '2024-01-01 10:00:00')"; clocked.Schemas[1].CreateSQL != want {
+		t.Errorf("CreateSQL = %q, quer %q", clocked.Schemas[1].CreateSQL, want)
+	}
+	if caso.Schemas[1].CreateSQL != "CREATE TABLE b (em TEXT DEFAULT CURRENT_TIMESTAMP)" {
+		t.Error("o caso original não pode ser alterado")
+	}
+	if p.sandboxCase(caso, ana) != clocked {
+		t.Error("a mesma progressão deveria reaproveitar a cópia")
+	}
+
+	other := p.sandboxCase(caso, bia)
+	if other.SandboxClock == clocked.SandboxClock {
+		t.Errorf("progressões diferentes com o mesmo relógio %q", other.SandboxClock)
+	}
+
+	plain := &models.Case{ID: "d", Version: 1, Schemas: caso.Schemas[:1]}
+	if p.sandboxCase(plain, ana) != plain || p.sandboxCase(plain, bia) != plain {
+		t.Error("schema sem relógio deveria ser devolvido como está")
+	}
+}
@@ -0,0 +1,289 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"casos-de-codigo-api/internal/textdist"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	syntaxNearRe     = regexp.MustCompile(`near "(.*)": syntax error`)
+	unknownTableRe   = regexp.MustCompile(`no such table: (\S+)`)
+	unknownColumnRe  = regexp.MustCompile(`no such column: (\S+)`)
+	ambiguousRe      = regexp.MustCompile(`ambiguous column name: (\S+)`)
+	unknownFuncRe    = regexp.MustCompile(`no such function: (\S+)`)
+	constraintRe     = regexp.MustCompile(`(UNIQUE|NOT NULL|CHECK|FOREIGN KEY) constraint failed(?:: (.+))?`)
+	unrecognizedRe   = regexp.MustCompile(`unrecognized token: "(.*)"`)
+	maxSuggestions   = 3
+	sqlErrorFallback = "Ocorreu um erro ao executar o comando. Revise a consulta e tente novamente."
+)
+
+type schemaInfo struct {
+	tables  []string
+	columns map[string][]string
+}
+
+// classifySQLError traduz a mensagem crua do go-sqlite3 para a taxonomia de
+// erros do jogo, com explicação em português e sugestões tiradas do schema
+// do sandbox (restrito às tabelas liberadas no puzzle).
+func classifySQLError(sb *db.Sandbox, puzzle *models.Puzzle, err error) models.SQLErrorDetail {
+	raw := err.Error()
+	detail := models.SQLErrorDetail{
+		Class:       models.ErrorClassExecution,
+		Raw:         raw,
+		Explanation: sqlErrorFallback,
+	}
+
+	switch {
+	case syntaxNearRe.MatchString(raw):
+		near := syntaxNearRe.FindStringSubmatch(raw)[1]
+		detail.Class = models.ErrorClassSyntax
+		detail.Explanation = fmt.Sprintf("O banco não entendeu o comando perto de \"%s\". Confira vírgulas, parênteses, aspas e a ordem das cláusulas (SELECT ... FROM ... WHERE ...).", near)
+		detail.Suggestions = closestMatches(near, sqlKeywords)
+
+	case strings.Contains(raw, "incomplete input"):
+		detail.Class = models.ErrorClassSyntax
+		detail.Explanation = "O comando terminou antes do esperado. Talvez falte fechar um parêntese, uma aspa ou completar uma cláusula."
+
+	case unrecognizedRe.MatchString(raw):
+		token := unrecognizedRe.FindStringSubmatch(raw)[1]
+		detail.Class = models.ErrorClassSyntax
+		detail.Explanation = fmt.Sprintf("O trecho %s não é reconhecido como SQL. Textos devem ficar entre aspas simples, como 'Ana'.", token)
+		if strings.HasPrefix(token, "'") {
+			detail.Explanation = fmt.Sprintf("Uma aspa simples foi aberta e não foi fechada em %s. Feche o texto com outra aspa simples.", token)
+		}
+
+	case unknownFuncRe.MatchString(raw):
+		name := unknownFuncRe.FindStringSubmatch(raw)[1]
+		detail.Class = models.ErrorClassSyntax
+		detail.Explanation = fmt.Sprintf("A função %s não existe neste banco. Confira o nome da função.", name)
+		detail.Suggestions = closestMatches(name, sqlFunctions)
+
+	case unknownTableRe.MatchString(raw):
+		name := unknownTableRe.FindStringSubmatch(raw)[1]
+		schema := loadSchemaInfo(sb, puzzle)
+		detail.Class = models.ErrorClassUnknownTable
+		detail.Explanation = fmt.Sprintf("A tabela \"%s\" não existe neste banco. Verifique a grafia ou consulte as tabelas disponíveis.", name)
+		detail.Suggestions = closestMatches(lastPart(name), schema.tables)
+
+	case unknownColumnRe.MatchString(raw):
+		name := unknownColumnRe.FindStringSubmatch(raw)[1]
+		schema := loadSchemaInfo(sb, puzzle)
+		detail.Class = models.ErrorClassUnknownColumn
+		detail.Explanation = fmt.Sprintf("A coluna \"%s\" não existe nas tabelas usadas na consulta. Confira a grafia e de qual tabela ela vem.", name)
+		detail.Suggestions = columnSuggestions(name, schema)
+
+	case ambiguousRe.MatchString(raw):
+		name := ambiguousRe.FindStringSubmatch(raw)[1]
+		schema := loadSchemaInfo(sb, puzzle)
+		detail.Class = models.ErrorClassAmbiguousColumn
+		detail.Explanation = fmt.Sprintf("A coluna \"%s\" existe em mais de uma tabela da consulta. Indique de qual tabela ela vem, por exemplo tabela.%s.", name, name)
+		for _, table := range schema.tables {
+			for _, col := range schema.columns[table] {
+				if strings.EqualFold(col, name) {
+					detail.Suggestions = append(detail.Suggestions, table+"."+col)
+				}
+			}
+		}
+
+	case constraintRe.MatchString(raw):
+		m := constraintRe.FindStringSubmatch(raw)
+		detail.Class = models.ErrorClassConstraint
+		detail.Explanation = constraintExplanation(m[1], m[2])
+
+	case strings.Contains(raw, "datatype mismatch"):
+		detail.Class = models.ErrorClassConstraint
+		detail.Explanation = "O tipo do valor não é compatível com a coluna. Confira se números não estão entre aspas e se textos estão."
+	}
+
+	return detail
+}
+
+func constraintExplanation(kind, target string) string {
+	switch kind {
+	case "UNIQUE":
+		return fmt.Sprintf("Já existe um registro com esse valor em %s, que não aceita repetições.", target)
+	case "NOT NULL":
+		return fmt.Sprintf("A coluna %s é obrigatória e não pode ficar vazia (NULL).", target)
+	case "CHECK":
+		return "O valor informado viola uma regra de validação (CHECK) da tabela."
+	case "FOREIGN KEY":
+		return "O comando quebraria uma ligação entre tabelas: o registro referencia (ou é referenciado por) outro que não existe."
+	}
+	return sqlErrorFallback
+}
+
+func (p *GameProcessor) executionErrorResponse(
+	ctx context.Context,
+	caso *models.Case,
+	progression *models.Progression,
+	dbInstance *db.Sandbox,
+	err error,
+) *models.GameResponse {
+	puzzle := findPuzzle(caso, progression.CurrentPuzzle)
+
+	var detail models.SQLErrorDetail
+	code := models.ErrInvalidSQL
+
+	if denial := dbInstance.Policy.TakeDenial(); denial != nil {
+		code = models.ErrPolicyDenied
+		detail = models.SQLErrorDetail{Class: models.ErrorClassPolicyDenied, Explanation: denial.Message}
+		if denial.Action == "table" {
+			code = models.ErrTableDenied
+			detail.Explanation = tableDeniedMessage(puzzle, denial.Target)
+		}
+	} else if ctx.Err() != nil {
+		code = models.ErrQueryTimeout
+		detail = models.SQLErrorDetail{
+			Class:       models.ErrorClassTimeout,
+			Explanation: fmt.Sprintf("A consulta excedeu o limite de %s e foi interrompida. Verifique se não há recursões infinitas ou junções sem condição.", p.SQLiteFactory.Limits.QueryTimeout),
+		}
+	} else {
+		detail = classifySQLError(dbInstance, puzzle, err)
+	}
+
+	return &models.GameResponse{
+		Success:     false,
+		Error:       detail.Explanation,
+		ErrorCode:   code,
+		ErrorClass:  detail.Class,
+		ErrorDetail: &detail,
+		State:       p.getCurrentState(caso, progression),
+	}
+}
+
+func errorClassForCode(code string) string {
+	switch code {
+	case models.ErrFocusRequired:
+		return models.ErrorClassFocusRequired
+	case models.ErrPolicyDenied, models.ErrStatementDenied, models.ErrTableDenied:
+		return models.ErrorClassPolicyDenied
+	}
+	return models.ErrorClassExecution
+}
+
+func loadSchemaInfo(sb *db.Sandbox, puzzle *models.Puzzle) schemaInfo {
+	info := schemaInfo{columns: map[string][]string{}}
+
+	allowed := map[string]bool{}
+	if puzzle != nil {
+		for _, t := range puzzle.AllowedTables {
+			allowed[strings.ToLower(t)] = true
+		}
+	}
+
+	_ = sb.Trusted(func() error {
+		rows, err := sb.Query(`SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name string
+			if rows.Scan(&name) == nil && (len(allowed) == 0 || allowed[strings.ToLower(name)]) {
+				info.tables = append(info.tables, name)
+			}
+		}
+		rows.Close()
+
+		for _, table := range info.tables {
+			cols, err := sb.Query(`SELECT name FROM pragma_table_info(?)`, table)
+			if err != nil {
+				continue
+			}
+			for cols.Next() {
+				var col string
+				if cols.Scan(&col) == nil {
+					info.columns[table] = append(info.columns[table], col)
+				}
+			}
+			cols.Close()
+		}
+		return nil
+	})
+
+	return info
+}
+
+func columnSuggestions(name string, schema schemaInfo) []string {
+	qualifier := ""
+	column := name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		qualifier = name[:i]
+		column = name[i+1:]
+	}
+
+	candidates := make([]string, 0)
+	for _, table := range schema.tables {
+		if qualifier != "" && strings.EqualFold(table, qualifier) {
+			return closestMatches(column, schema.columns[table])
+		}
+		candidates = append(candidates, schema.columns[table]...)
+	}
+	return closestMatches(column, candidates)
+}
+
+func lastPart(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// closestMatches devolve os candidatos mais parecidos com name pela distância
+// de edição, aceitando até um terço do tamanho do nome em diferenças.
+func closestMatches(name string, candidates []string) []string {
+	target := strings.ToLower(name)
+	maxDist := len([]rune(target)) / 3
+	if maxDist < 1 {
+		maxDist = 1
+	}
+
+	type match struct {
+		value string
+		dist  int
+	}
+	seen := map[string]bool{}
+	matches := make([]match, 0)
+	for _, c := range candidates {
+		lower := strings.ToLower(c)
+		if seen[lower] || lower == target {
+			continue
+		}
+		seen[lower] = true
+		if d := textdist.Levenshtein(target, lower); d <= maxDist {
+			matches = append(matches, match{value: c, dist: d})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].dist < matches[j].dist
+	})
+
+	result := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		result = append(result, matches[i].value)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+var sqlKeywords = []string{
+	"SELECT", "FROM", "WHERE", "AND", "OR", "NOT", "IN", "LIKE", "BETWEEN",
+	"JOIN", "INNER", "LEFT", "ON", "GROUP", "BY", "ORDER", "HAVING", "LIMIT",
+	"OFFSET", "DISTINCT", "AS", "UPDATE", "SET", "INSERT", "INTO", "VALUES",
+	"DELETE", "NULL", "IS", "ASC", "DESC", "UNION", "CASE", "WHEN", "THEN",
+	"ELSE", "END", "WITH", "EXISTS",
+}
+
+var sqlFunctions = []string{
+	"COUNT", "SUM", "AVG", "MIN", "MAX", "LOWER", "UPPER", "LENGTH", "SUBSTR",
+	"TRIM", "REPLACE", "ROUND", "ABS", "COALESCE", "IFNULL", "DATE", "TIME",
+	"DATETIME", "STRFTIME", "INSTR", "GROUP_CONCAT", "CAST", "JULIANDAY",
+}
@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"strings"
+)
+
+type sqlTokenKind int
+
+const (
+	tokWord sqlTokenKind = iota
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokSymbol
+)
+
+// sqlToken guarda o texto original e a posição no SQL, permitindo reescritas
+// pontuais sem perder a formatação digitada pelo jogador.
+type sqlToken struct {
+	Kind  sqlTokenKind
+	Text  string
+	Start int
+	End   int
+}
+
+func (t sqlToken) upper() string {
+	return strings.ToUpper(t.Text)
+}
+
+func (t sqlToken) isWord(words ...string) bool {
+	if t.Kind != tokWord {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.Text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t sqlToken) isSymbol(symbols ...string) bool {
+	if t.Kind != tokSymbol {
+		return false
+	}
+	for _, s := range symbols {
+		if t.Text == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (t sqlToken) isName() bool {
+	return t.Kind == tokWord || t.Kind == tokQuotedIdent
+}
+
+// name devolve o identificador sem aspas e em minúsculas quando não estava
+// entre aspas, que é como o SQLite resolve nomes de tabelas e colunas.
+func (t sqlToken) name() string {
+	switch t.Kind {
+	case tokQuotedIdent:
+		if len(t.Text) < 2 {
+			return t.Text
+		}
+		inner := t.Text[1 : len(t.Text)-1]
+		switch t.Text[0] {
+		case '"':
+			return strings.ReplaceAll(inner, `""`, `"`)
+		case '`':
+			return strings.ReplaceAll(inner, "``", "`")
+		}
+		return inner
+	default:
+		return strings.ToLower(t.Text)
+	}
+}
+
+var multiCharSymbols = []string{"->>", "->", "<=", ">=", "<>", "!=", "==", "||", "<<", ">>"}
+
+func tokenizeSQL(query string) []sqlToken {
+	tokens := make([]sqlToken, 0, len(query)/4)
+	i := 0
+	n := len(query)
+
+	for i < n {
+		c := query[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+
+		case c == '-' && i+1 < n && query[i+1] == '-':
+			for i < n && query[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 4
+			}
+
+		case c == '\'':
+			start := i
+			i = scanQuoted(query, i, '\'')
+			tokens = append(tokens, sqlToken{Kind: tokString, Text: query[start:i], Start: start, End: i})
+
+		case (c == 'x' || c == 'X') && i+1 < n && query[i+1] == '\'':
+			start := i
+			i = scanQuoted(query, i+1, '\'')
+			tokens = append(tokens, sqlToken{Kind: tokString, Text: query[start:i], Start: start, End: i})
+
+		case c == '"' || c == '`':
+			start := i
+			i = scanQuoted(query, i, c)
+			tokens = append(tokens, sqlToken{Kind: tokQuotedIdent, Text: query[start:i], Start: start, End: i})
+
+		case c == '[':
+			start := i
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 1
+			}
+			tokens = append(tokens, sqlToken{Kind: tokQuotedIdent, Text: query[start:i], Start: start, End: i})
+
+		case isDigit(c) || (c == '.' && i+1 < n && isDigit(query[i+1])):
+			start := i
+			i = scanNumber(query, i)
+			tokens = append(tokens, sqlToken{Kind: tokNumber, Text: query[start:i], Start: start, End: i})
+
+		case isWordStart(c):
+			start := i
+			for i < n && isWordPart(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{Kind: tokWord, Text: query[start:i], Start: start, End: i})
+
+		default:
+			start := i
+			size := 1
+			for _, sym := range multiCharSymbols {
+				if strings.HasPrefix(query[i:], sym) {
+					size = len(sym)
+					break
+				}
+			}
+			i += size
+			tokens = append(tokens, sqlToken{Kind: tokSymbol, Text: query[start:i], Start: start, End: i})
+		}
+	}
+
+	return tokens
+}
+
+// scanQuoted avança até o delimitador de fechamento, tratando a repetição
+// do delimitador como escape. Strings sem fechamento vão até o fim da entrada.
+func scanQuoted(query string, i int, quote byte) int {
+	i++
+	for i < len(query) {
+		if query[i] == quote {
+			if i+1 < len(query) && query[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return len(query)
+}
+
+func scanNumber(query string, i int) int {
+	n := len(query)
+	if strings.HasPrefix(strings.ToLower(query[i:]), "0x") {
+		i += 2
+		for i < n && isHexDigit(query[i]) {
+			i++
+		}
+		return i
+	}
+	for i < n && (isDigit(query[i]) || query[i] == '.' || query[i] == '_') {
+		i++
+	}
+	if i < n && (query[i] == 'e' || query[i] == 'E') {
+		j := i + 1
+		if j < n && (query[j] == '+' || query[j] == '-') {
+			j++
+		}
+		if j < n && isDigit(query[j]) {
+			i = j
+			for i < n && isDigit(query[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c == ':' || c == '?' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || isDigit(c)
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeSQL(t *testing.T) {
+	type tok struct {
+		Kind sqlTokenKind
+		Text string
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []tok
+	}{
+		{"vazio", "", []tok{}},
+		{"só comentários", "-- nada\n/* nada */", []tok{}},
+		{
+			"select simples",
+			"SELECT nome FROM suspeitos;",
+			[]tok{{tokWord, "SELECT"}, {tokWord, "nome"}, {tokWord, "FROM"}, {tokWord, "suspeitos"}, {tokSymbol, ";"}},
+		},
+		{
+			"comentários no meio",
+			"SELECT -- colunas\n* /* todas */ FROM t",
+			[]tok{{tokWord, "SELECT"}, {tokSymbol, "*"}, {tokWord, "FROM"}, {tokWord, "t"}},
+		},
+		{
+			"comentário de bloco sem fim",
+			"SELECT 1 /* aberto",
+			[]tok{{tokWord, "SELECT"}, {tokNumber, "1"}},
+		},
+		{
+			"texto com aspas escapadas",
+			"SELECT 'it''s -- não é comentário'",
+			[]tok{{tokWord, "SELECT"}, {tokString, "'it''s -- não é comentário'"}},
+		},
+		{
+			"blob",
+			"SELECT x'0A1b', X'ff'",
+			[]tok{{tokWord, "SELECT"}, {tokString, "x'0A1b'"}, {tokSymbol, ","}, {tokString, "X'ff'"}},
+		},
+		{
+			"identificadores entre aspas",
+			"SELECT \"nome completo\", `ano`, [local] FROM t",
+			[]tok{
+				{tokWord, "SELECT"}, {tokQuotedIdent, "\"nome completo\""}, {tokSymbol, ","},
+				{tokQuotedIdent, "`ano`"}, {tokSymbol, ","}, {tokQuotedIdent, "[local]"},
+				{tokWord, "FROM"}, {tokWord, "t"},
+			},
+		},
+		{
+			"números",
+			"SELECT 42, 3.14, .5, 1e10, 2.5E-3, 0x1F",
+			[]tok{
+				{tokWord, "SELECT"}, {tokNumber, "42"}, {tokSymbol, ","}, {tokNumber, "3.14"}, {tokSymbol, ","},
+				{tokNumber, ".5"}, {tokSymbol, ","}, {tokNumber, "1e10"}, {tokSymbol, ","},
+				{tokNumber, "2.5E-3"}, {tokSymbol, ","}, {tokNumber, "0x1F"},
+			},
+		},
+		{
+			"operadores de mais de um caractere",
+			"a<=b>=c<>d!=e==f||g->>h->i<<j>>k",
+			[]tok{
+				{tokWord, "a"}, {tokSymbol, "<="}, {tokWord, "b"}, {tokSymbol, ">="}, {tokWord, "c"},
+				{tokSymbol, "<>"}, {tokWord, "d"}, {tokSymbol, "!="}, {tokWord, "e"}, {tokSymbol, "=="},
+				{tokWord, "f"}, {tokSymbol, "||"}, {tokWord, "g"}, {tokSymbol, "->>"}, {tokWord, "h"},
+				{tokSymbol, "->"}, {tokWord, "i"}, {tokSymbol, "<<"}, {tokWord, "j"}, {tokSymbol, ">>"},
+				{tokWord, "k"},
+			},
+		},
+		{
+			"nome qualificado",
+			"main.suspeitos.nome",
+			[]tok{{tokWord, "main"}, {tokSymbol, "."}, {tokWord, "suspeitos"}, {tokSymbol, "."}, {tokWord, "nome"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]tok, 0)
+			for _, token := range tokenizeSQL(tt.query) {
+				if tt.query[token.Start:token.End] != token.Text {
+					t.Errorf("token %q fora da posição [%d:%d]", token.Text, token.Start, token.End)
+				}
+				got = append(got, tok{token.Kind, token.Text})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenizeSQL(%q)\n got: %v\nwant: %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLTokenName(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"Suspeitos", "suspeitos"},
+		{"\"Suspeitos\"", "Suspeitos"},
+		{"\"com \"\"aspas\"\"\"", "com \"aspas\""},
+		{"`Ano`", "Ano"},
+		{"[Local]", "Local"},
+	}
+
+	for _, tt := range tests {
+		tokens := tokenizeSQL(tt.query)
+		if len(tokens) != 1 {
+			t.Fatalf("tokenizeSQL(%q) = %d tokens, quer 1", tt.query, len(tokens))
+		}
+		if got := tokens[0].name(); got != tt.want {
+			t.Errorf("name(%q) = %q, quer %q", tt.query, got, tt.want)
+		}
+	}
+}
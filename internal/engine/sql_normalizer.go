@@ -1,35 +1,322 @@
 package engine
 
 import (
-	"regexp"
+	"sort"
+	"strings"
 )
 
-var whereRegex = regexp.MustCompile(`(?is)(.*?\bwhere\b)(.*)`)
+type sqlEdit struct {
+	Start       int
+	End         int
+	Replacement string
+}
 
+// NormalizeSQL torna case-insensitive as comparações entre colunas e literais
+// de texto (=, ==, !=, <>, LIKE e IN) em qualquer ponto do comando: WHERE,
+// HAVING, JOIN ... ON e subconsultas. Atribuições de UPDATE ... SET e textos
+// dentro de literais não são tocados. Os dois lados passam pela CASEFOLD do
+// sandbox, que, ao contrário de LOWER, converte também letras acentuadas.
 func NormalizeSQL(query string) string {
-	matches := whereRegex.FindStringSubmatch(query)
-	if len(matches) != 3 {
-		return query // não tem WHERE → não mexe
+	tokens := tokenizeSQL(query)
+	if len(tokens) == 0 {
+		return query
+	}
+
+	switch classifyTokens(tokens).Kind {
+	case StmtSelect, StmtValues, StmtExplain, StmtInsert, StmtUpdate, StmtDelete, StmtCreateView:
+	default:
+		return query
+	}
+
+	edits := comparisonEdits(query, tokens)
+	if len(edits) == 0 {
+		return query
+	}
+
+	return applyEdits(query, edits)
+}
+
+func comparisonEdits(query string, tokens []sqlToken) []sqlEdit {
+	edits := make([]sqlEdit, 0)
+	wrapped := map[int]bool{}
+
+	wrap := func(start, end int) {
+		if wrapped[start] {
+			return
+		}
+		wrapped[start] = true
+		edits = append(edits, sqlEdit{
+			Start:       start,
+			End:         end,
+			Replacement: "CASEFOLD(" + query[start:end] + ")",
+		})
 	}
 
-	head := matches[1]
-	whereClause := matches[2]
+	inSet := []bool{false}
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		depth := len(inSet) - 1
+
+		switch {
+		case tok.isSymbol("("):
+			inSet = append(inSet, false)
+			continue
+		case tok.isSymbol(")"):
+			if depth > 0 {
+				inSet = inSet[:depth]
+			}
+			continue
+		case tok.isSymbol(";"):
+			inSet = []bool{false}
+			continue
+		case tok.isWord("SET"):
+			inSet[depth] = true
+			continue
+		case tok.isWord("WHERE", "FROM", "RETURNING"):
+			inSet[depth] = false
+			continue
+		}
+
+		if inSet[depth] {
+			continue
+		}
+
+		opEnd := comparisonOperatorEnd(tokens, i)
+		if opEnd < 0 {
+			continue
+		}
+
+		if tokens[opEnd].isWord("IN") {
+			colStart, ok := columnRefStart(tokens, i-1)
+			if !ok {
+				continue
+			}
+			literals, ok := stringList(tokens, opEnd+1)
+			if !ok {
+				continue
+			}
+			wrap(tokens[colStart].Start, tokens[i-1].End)
+			for _, lit := range literals {
+				wrap(lit.Start, lit.End)
+			}
+			continue
+		}
+
+		left := i - 1
+		right := opEnd + 1
+		if left < 0 || right >= len(tokens) {
+			continue
+		}
 
-	whereClause = normalizeWhere(whereClause)
+		// cada lado é a expressão inteira até o operador: em
+		// nome = 'ana' || 'x', o || vem antes da comparação
+		leftStart := exprStart(tokens, left)
+		rightEnd := exprEnd(tokens, right)
 
-	return head + whereClause
+		if _, ok := columnRefStart(tokens, left); ok && tokens[right].Kind == tokString && !isBlobLiteral(tokens[right]) {
+			wrap(tokens[leftStart].Start, tokens[left].End)
+			wrap(tokens[right].Start, tokens[rightEnd].End)
+			continue
+		}
+
+		if tokens[left].Kind == tokString && !isBlobLiteral(tokens[left]) && !tokens[opEnd].isWord("LIKE") {
+			if _, ok := columnRefEnd(tokens, right); ok {
+				wrap(tokens[leftStart].Start, tokens[left].End)
+				wrap(tokens[right].Start, tokens[rightEnd].End)
+			}
+		}
+	}
+
+	return edits
 }
 
-func normalizeWhere(where string) string {
+// comparisonOperatorEnd reconhece um operador de comparação começando em i e
+// devolve o índice do seu último token, ou -1.
+func comparisonOperatorEnd(tokens []sqlToken, i int) int {
+	tok := tokens[i]
+	if tok.isSymbol("=", "==", "!=", "<>") {
+		return i
+	}
+	if tok.isWord("LIKE") {
+		return i
+	}
+	if tok.isWord("IN") && i+1 < len(tokens) && tokens[i+1].isSymbol("(") {
+		return i
+	}
+	if tok.isWord("NOT") && i+1 < len(tokens) {
+		next := tokens[i+1]
+		if next.isWord("LIKE") {
+			return i + 1
+		}
+		if next.isWord("IN") && i+2 < len(tokens) && tokens[i+2].isSymbol("(") {
+			return i + 1
+		}
+	}
+	return -1
+}
 
-	eq := regexp.MustCompile(`(?i)\b(\w+)\s*=\s*'([^']*)'`)
-	where = eq.ReplaceAllString(where, "LOWER($1) = LOWER('$2')")
+var nonColumnWords = map[string]bool{
+	"NULL": true, "TRUE": true, "FALSE": true, "END": true, "NOT": true,
+	"AND": true, "OR": true, "WHERE": true, "ON": true, "HAVING": true,
+	"WHEN": true, "THEN": true, "ELSE": true, "CASE": true, "SET": true,
+	"SELECT": true, "CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true,
+}
 
-	neq := regexp.MustCompile(`(?i)\b(\w+)\s*!=\s*'([^']*)'`)
-	where = neq.ReplaceAllString(where, "LOWER($1) != LOWER('$2')")
+func isColumnName(tok sqlToken) bool {
+	if tok.Kind == tokQuotedIdent {
+		return true
+	}
+	return tok.Kind == tokWord && !nonColumnWords[tok.upper()] && !strings.HasPrefix(tok.Text, "?")
+}
 
-	like := regexp.MustCompile(`(?i)\b(\w+)\s+LIKE\s+'([^']*)'`)
-	where = like.ReplaceAllString(where, "LOWER($1) LIKE LOWER('$2')")
+// columnRefStart caminha para trás a partir de end sobre uma referência de
+// coluna (coluna, tabela.coluna ou esquema.tabela.coluna).
+func columnRefStart(tokens []sqlToken, end int) (int, bool) {
+	if end < 0 || !isColumnName(tokens[end]) {
+		return 0, false
+	}
+	start := end
+	for start >= 2 && tokens[start-1].isSymbol(".") && tokens[start-2].isName() {
+		start -= 2
+	}
+	if start > 0 && tokens[start-1].isSymbol(".") {
+		return 0, false
+	}
+	return start, true
+}
 
-	return where
+func columnRefEnd(tokens []sqlToken, start int) (int, bool) {
+	if start >= len(tokens) || !isColumnName(tokens[start]) {
+		return 0, false
+	}
+	end := start
+	for end+2 < len(tokens) && tokens[end+1].isSymbol(".") && tokens[end+2].isName() {
+		end += 2
+	}
+	if end+1 < len(tokens) && tokens[end+1].isSymbol("(", ".") {
+		return 0, false
+	}
+	return end, true
+}
+
+// binaryOperators têm precedência maior que a das comparações, então o
+// operando de um = termina só depois deles.
+var binaryOperators = map[string]bool{
+	"||": true, "+": true, "-": true, "*": true, "/": true, "%": true,
+	"&": true, "|": true, "<<": true, ">>": true, "->": true, "->>": true,
+}
+
+func isBinaryOperator(tok sqlToken) bool {
+	return tok.Kind == tokSymbol && binaryOperators[tok.Text]
+}
+
+// exprEnd avança sobre operandos ligados por binaryOperators a partir de
+// start e devolve o índice do último token da expressão.
+func exprEnd(tokens []sqlToken, start int) int {
+	end := operandEnd(tokens, start)
+	for end+2 < len(tokens) && isBinaryOperator(tokens[end+1]) {
+		end = operandEnd(tokens, end+2)
+	}
+	return end
+}
+
+// exprStart é o inverso de exprEnd, caminhando para trás a partir de end.
+func exprStart(tokens []sqlToken, end int) int {
+	start := operandStart(tokens, end)
+	for start >= 2 && isBinaryOperator(tokens[start-1]) {
+		start = operandStart(tokens, start-2)
+	}
+	return start
+}
+
+// operandEnd pula um literal, uma referência de coluna, uma chamada de
+// função ou uma expressão entre parênteses.
+func operandEnd(tokens []sqlToken, i int) int {
+	if tokens[i].isName() && i+1 < len(tokens) && tokens[i+1].isSymbol("(") {
+		i++
+	}
+	if tokens[i].isSymbol("(") {
+		depth := 0
+		for j := i; j < len(tokens); j++ {
+			switch {
+			case tokens[j].isSymbol("("):
+				depth++
+			case tokens[j].isSymbol(")"):
+				depth--
+				if depth == 0 {
+					return j
+				}
+			}
+		}
+		return len(tokens) - 1
+	}
+	if end, ok := columnRefEnd(tokens, i); ok {
+		return end
+	}
+	return i
+}
+
+func operandStart(tokens []sqlToken, i int) int {
+	if tokens[i].isSymbol(")") {
+		depth := 0
+		for j := i; j >= 0; j-- {
+			switch {
+			case tokens[j].isSymbol(")"):
+				depth++
+			case tokens[j].isSymbol("("):
+				depth--
+				if depth == 0 {
+					if j > 0 && tokens[j-1].isName() && !nonColumnWords[tokens[j-1].upper()] {
+						return j - 1
+					}
+					return j
+				}
+			}
+		}
+		return 0
+	}
+	if start, ok := columnRefStart(tokens, i); ok {
+		return start
+	}
+	return i
+}
+
+func stringList(tokens []sqlToken, open int) ([]sqlToken, bool) {
+	if open >= len(tokens) || !tokens[open].isSymbol("(") {
+		return nil, false
+	}
+	literals := make([]sqlToken, 0)
+	for i := open + 1; i < len(tokens); i += 2 {
+		if tokens[i].Kind != tokString || isBlobLiteral(tokens[i]) {
+			return nil, false
+		}
+		literals = append(literals, tokens[i])
+		if i+1 >= len(tokens) {
+			return nil, false
+		}
+		if tokens[i+1].isSymbol(")") {
+			return literals, true
+		}
+		if !tokens[i+1].isSymbol(",") {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func isBlobLiteral(tok sqlToken) bool {
+	return tok.Kind == tokString && len(tok.Text) > 0 && (tok.Text[0] == 'x' || tok.Text[0] == 'X')
+}
+
+func applyEdits(query string, edits []sqlEdit) string {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].Start > edits[j].Start
+	})
+
+	result := query
+	for _, e := range edits {
+		result = result[:e.Start] + e.Replacement + result[e.End:]
+	}
+	return result
 }
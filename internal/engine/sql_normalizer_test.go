@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			"igualdade no WHERE",
+			"SELECT * FROM suspeitos WHERE nome = 'Ana'",
+			"SELECT * FROM suspeitos WHERE CASEFOLD(nome) = CASEFOLD('Ana')",
+		},
+		{
+			"literal à esquerda",
+			"SELECT * FROM suspeitos WHERE 'Ana' == s.nome",
+			"SELECT * FROM suspeitos WHERE CASEFOLD('Ana') == CASEFOLD(s.nome)",
+		},
+		{
+			"diferença e LIKE",
+			"SELECT * FROM t WHERE a != 'x' AND b <> 'y' AND c LIKE 'z%' AND d NOT LIKE 'w'",
+			"SELECT * FROM t WHERE CASEFOLD(a) != CASEFOLD('x') AND CASEFOLD(b) <> CASEFOLD('y') AND CASEFOLD(c) LIKE CASEFOLD('z%') AND CASEFOLD(d) NOT LIKE CASEFOLD('w')",
+		},
+		{
+			"IN com lista de textos",
+			"SELECT * FROM t WHERE cor IN ('Azul', 'Verde')",
+			"SELECT * FROM t WHERE CASEFOLD(cor) IN (CASEFOLD('Azul'), CASEFOLD('Verde'))",
+		},
+		{
+			"NOT IN",
+			"SELECT * FROM t WHERE cor NOT IN ('Azul')",
+			"SELECT * FROM t WHERE CASEFOLD(cor) NOT IN (CASEFOLD('Azul'))",
+		},
+		{
+			"IN com números fica igual",
+			"SELECT * FROM t WHERE id IN (1, 2)",
+			"SELECT * FROM t WHERE id IN (1, 2)",
+		},
+		{
+			"JOIN ON e HAVING",
+			"SELECT a.x FROM a JOIN b ON b.tipo = 'Arma' GROUP BY a.x HAVING a.x = 'K'",
+			"SELECT a.x FROM a JOIN b ON CASEFOLD(b.tipo) = CASEFOLD('Arma') GROUP BY a.x HAVING CASEFOLD(a.x) = CASEFOLD('K')",
+		},
+		{
+			"subconsulta",
+			"SELECT * FROM a WHERE id IN (SELECT id FROM b WHERE nome = 'Rui')",
+			"SELECT * FROM a WHERE id IN (SELECT id FROM b WHERE CASEFOLD(nome) = CASEFOLD('Rui'))",
+		},
+		{
+			"números e colunas não mudam",
+			"SELECT * FROM t WHERE id = 3 AND a = b",
+			"SELECT * FROM t WHERE id = 3 AND a = b",
+		},
+		{
+			"blob não muda",
+			"SELECT * FROM t WHERE dado = x'00ff'",
+			"SELECT * FROM t WHERE dado = x'00ff'",
+		},
+		{
+			"texto dentro de literal não muda",
+			"SELECT 'a = ''b''' FROM t",
+			"SELECT 'a = ''b''' FROM t",
+		},
+		{
+			"atribuições do SET ficam intactas",
+			"UPDATE suspeitos SET status = 'Preso', nota = 'Culpado' WHERE nome = 'Ana'",
+			"UPDATE suspeitos SET status = 'Preso', nota = 'Culpado' WHERE CASEFOLD(nome) = CASEFOLD('Ana')",
+		},
+		{
+			"SET com subconsulta",
+			"UPDATE t SET x = (SELECT y FROM u WHERE u.k = 'A') WHERE t.k = 'B'",
+			"UPDATE t SET x = (SELECT y FROM u WHERE CASEFOLD(u.k) = CASEFOLD('A')) WHERE CASEFOLD(t.k) = CASEFOLD('B')",
+		},
+		{
+			"SET seguido de RETURNING",
+			"UPDATE t SET a = 'X' RETURNING a = 'Y'",
+			"UPDATE t SET a = 'X' RETURNING CASEFOLD(a) = CASEFOLD('Y')",
+		},
+		{
+			"UPSERT",
+			"INSERT INTO t (k) VALUES ('a') ON CONFLICT DO UPDATE SET k = 'b' WHERE k = 'c'",
+			"INSERT INTO t (k) VALUES ('a') ON CONFLICT DO UPDATE SET k = 'b' WHERE CASEFOLD(k) = CASEFOLD('c')",
+		},
+		{
+			"DELETE",
+			"DELETE FROM provas WHERE tipo = 'Faca'",
+			"DELETE FROM provas WHERE CASEFOLD(tipo) = CASEFOLD('Faca')",
+		},
+		{
+			"DDL não é tocado",
+			"CREATE TABLE t (status TEXT CHECK (status = 'Ativo'))",
+			"CREATE TABLE t (status TEXT CHECK (status = 'Ativo'))",
+		},
+		{
+			"PRAGMA não é tocado",
+			"PRAGMA encoding = 'UTF-8'",
+			"PRAGMA encoding = 'UTF-8'",
+		},
+		{
+			"comentários são preservados",
+			"SELECT * FROM t -- filtro\nWHERE nome = 'Ana'",
+			"SELECT * FROM t -- filtro\nWHERE CASEFOLD(nome) = CASEFOLD('Ana')",
+		},
+		{
+			"concatenação à direita",
+			"SELECT * FROM t WHERE nome = 'ana' || 'x' AND id = 1",
+			"SELECT * FROM t WHERE CASEFOLD(nome) = CASEFOLD('ana' || 'x') AND id = 1",
+		},
+		{
+			"concatenação com coluna e função",
+			"SELECT * FROM t WHERE upper(nome) || ' ' || sobrenome = 'Ana ' || (SELECT 'Lima') ORDER BY 1",
+			"SELECT * FROM t WHERE CASEFOLD(upper(nome) || ' ' || sobrenome) = CASEFOLD('Ana ' || (SELECT 'Lima')) ORDER BY 1",
+		},
+		{
+			"literal à esquerda com expressão",
+			"SELECT * FROM t WHERE 'Ana' || 'x' = t.nome || t.sufixo",
+			"SELECT * FROM t WHERE CASEFOLD('Ana' || 'x') = CASEFOLD(t.nome || t.sufixo)",
+		},
+		{
+			"NOT não entra na expressão",
+			"SELECT * FROM t WHERE NOT nome = 'Ana'",
+			"SELECT * FROM t WHERE NOT CASEFOLD(nome) = CASEFOLD('Ana')",
+		},
+		{"vazio", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeSQL(tt.query); got != tt.want {
+				t.Errorf("NormalizeSQL(%q)\n got: %s\nwant: %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaseFoldInSandbox(t *testing.T) {
+	g := newTestGame(t, testCase())
+
+	tests := []struct {
+		query string
+		want  []interface{}
+	}{
+		{"SELECT nome FROM suspeitos WHERE cargo = 'ESTAGIÁRIA'", []interface{}{"Carla"}},
+		{"SELECT nome FROM suspeitos WHERE cargo IN ('estagiária', 'CHEFE') ORDER BY id", []interface{}{"Bruno", "Carla"}},
+		{"SELECT nome FROM suspeitos WHERE nome = 'BRU' || 'NO'", []interface{}{"Bruno"}},
+		{"SELECT nome FROM suspeitos WHERE id = '3'", []interface{}{"Carla"}},
+		{
+			"SELECT casefold(2.0) = LOWER(2.0) AND casefold(1e20) = LOWER(1e20) AND casefold(0.1) = LOWER(0.1) AND casefold(1e-5) = LOWER(1e-5) AND casefold(-3) = LOWER(-3) AND casefold(NULL) IS NULL",
+			[]interface{}{int64(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := g.column(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, quer %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package engine
+
+import "strings"
+
+type scriptStatement struct {
+	SQL  string
+	Stmt SQLStatement
+}
+
+// splitSQLScript separa a entrada em comandos pelos ";" de nível superior.
+// O corpo BEGIN ... END de um CREATE TRIGGER fica inteiro, já que seus ";"
+// pertencem ao gatilho; CASE ... END dentro dele é contado à parte.
+func splitSQLScript(query string) []scriptStatement {
+	tokens := tokenizeSQL(query)
+	statements := make([]scriptStatement, 0, 1)
+
+	start := 0
+	blockDepth := 0
+	caseDepth := 0
+
+	flush := func(end int) {
+		if end > start {
+			body := tokens[start:end]
+			statements = append(statements, scriptStatement{
+				SQL:  strings.TrimSpace(query[body[0].Start:body[len(body)-1].End]),
+				Stmt: classifyTokens(body),
+			})
+		}
+		start = end + 1
+	}
+
+	for i, tok := range tokens {
+		switch {
+		case tok.isWord("BEGIN") && isTriggerBody(tokens[start:i]):
+			blockDepth++
+		case tok.isWord("CASE") && blockDepth > 0:
+			caseDepth++
+		case tok.isWord("END") && blockDepth > 0:
+			if caseDepth > 0 {
+				caseDepth--
+			} else {
+				blockDepth--
+			}
+		case tok.isSymbol(";") && blockDepth == 0:
+			flush(i)
+		}
+	}
+	flush(len(tokens))
+
+	return statements
+}
+
+func isTriggerBody(prefix []sqlToken) bool {
+	return len(prefix) > 0 && classifyTokens(prefix).Kind == StmtCreateTrigger
+}
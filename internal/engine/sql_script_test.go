@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLScript(t *testing.T) {
+	trigger := "CREATE TRIGGER log AFTER INSERT ON provas BEGIN\n" +
+		"  INSERT INTO historico VALUES (NEW.id);\n" +
+		"  UPDATE contagem SET n = n + 1;\n" +
+		"END"
+	caseTrigger := "CREATE TRIGGER rotulo AFTER UPDATE ON suspeitos BEGIN\n" +
+		"  UPDATE suspeitos SET rotulo = CASE WHEN NEW.preso THEN 'preso' ELSE 'livre' END;\n" +
+		"  INSERT INTO historico VALUES (CASE NEW.id WHEN 1 THEN 'um' END);\n" +
+		"END"
+
+	tests := []struct {
+		name  string
+		query string
+		sql   []string
+		kinds []StatementKind
+	}{
+		{"vazio", "", []string{}, []StatementKind{}},
+		{"só separadores", " ; ;; ", []string{}, []StatementKind{}},
+		{
+			"um comando",
+			"SELECT 1",
+			[]string{"SELECT 1"},
+			[]StatementKind{StmtSelect},
+		},
+		{
+			"ponto e vírgula final",
+			"SELECT 1;",
+			[]string{"SELECT 1"},
+			[]StatementKind{StmtSelect},
+		},
+		{
+			"vários comandos",
+			"INSERT INTO t VALUES (1);\nSELECT * FROM t ;  DELETE FROM t",
+			[]string{"INSERT INTO t VALUES (1)", "SELECT * FROM t", "DELETE FROM t"},
+			[]StatementKind{StmtInsert, StmtSelect, StmtDelete},
+		},
+		{
+			"ponto e vírgula em texto e comentário",
+			"SELECT 'a;b' -- c;d\n; SELECT \"x;y\" /* ; */",
+			[]string{"SELECT 'a;b'", "SELECT \"x;y\""},
+			[]StatementKind{StmtSelect, StmtSelect},
+		},
+		{
+			"corpo de trigger inteiro",
+			trigger + "; SELECT * FROM historico",
+			[]string{trigger, "SELECT * FROM historico"},
+			[]StatementKind{StmtCreateTrigger, StmtSelect},
+		},
+		{
+			"CASE ... END dentro do trigger",
+			caseTrigger + ";\nINSERT INTO suspeitos VALUES (1)",
+			[]string{caseTrigger, "INSERT INTO suspeitos VALUES (1)"},
+			[]StatementKind{StmtCreateTrigger, StmtInsert},
+		},
+		{
+			"CASE fora de trigger",
+			"SELECT CASE WHEN 1 THEN 'a' END; SELECT 2",
+			[]string{"SELECT CASE WHEN 1 THEN 'a' END", "SELECT 2"},
+			[]StatementKind{StmtSelect, StmtSelect},
+		},
+		{
+			"BEGIN de transação não abre bloco",
+			"BEGIN; UPDATE t SET a = 1; COMMIT",
+			[]string{"BEGIN", "UPDATE t SET a = 1", "COMMIT"},
+			[]StatementKind{StmtBegin, StmtUpdate, StmtCommit},
+		},
+		{
+			"END de transação",
+			"BEGIN TRANSACTION; END TRANSACTION",
+			[]string{"BEGIN TRANSACTION", "END TRANSACTION"},
+			[]StatementKind{StmtBegin, StmtCommit},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := make([]string, 0)
+			kinds := make([]StatementKind, 0)
+			for _, s := range splitSQLScript(tt.query) {
+				sql = append(sql, s.SQL)
+				kinds = append(kinds, s.Stmt.Kind)
+			}
+			if !reflect.DeepEqual(sql, tt.sql) {
+				t.Errorf("SQL\n got: %q\nwant: %q", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("Kinds = %v, quer %v", kinds, tt.kinds)
+			}
+		})
+	}
+}
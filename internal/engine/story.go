@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"strings"
+)
+
+// applyStoryEffects aplica os efeitos de uma resposta de comando na
+// progressão e devolve os itens que entraram agora no inventário.
+func applyStoryEffects(prog *models.Progression, resp *models.CommandResponse) []string {
+	for _, flag := range resp.SetFlags {
+		if prog.Flags == nil {
+			prog.Flags = map[string]bool{}
+		}
+		prog.Flags[strings.ToLower(flag)] = true
+	}
+	for _, flag := range resp.ClearFlags {
+		delete(prog.Flags, strings.ToLower(flag))
+	}
+	for counter, delta := range resp.Increment {
+		if prog.Counters == nil {
+			prog.Counters = map[string]int{}
+		}
+		prog.Counters[strings.ToLower(counter)] += delta
+	}
+
+	added := make([]string, 0)
+	for _, item := range resp.AddItems {
+		item = strings.ToLower(item)
+		if containsFold(prog.Inventory, item) {
+			continue
+		}
+		prog.Inventory = append(prog.Inventory, item)
+		added = append(added, item)
+	}
+	return added
+}
+
+func itemName(caso *models.Case, id string) string {
+	for _, item := range caso.Items {
+		if strings.EqualFold(item.ID, id) && item.Name != "" {
+			return item.Name
+		}
+	}
+	return strings.ToUpper(id)
+}
+
+func (p *GameProcessor) handleInventory(caso *models.Case, prog *models.Progression) *models.GameResponse {
+	if len(prog.Inventory) == 0 {
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: "Seus bolsos estão vazios. Nada recolhido até agora.",
+			State:     p.getCurrentState(caso, prog),
+		}
+	}
+
+	lines := make([]string, 0, len(prog.Inventory))
+	for _, id := range prog.Inventory {
+		line := "- " + itemName(caso, id)
+		for _, item := range caso.Items {
+			if strings.EqualFold(item.ID, id) && item.Description != "" {
+				line += ": " + item.Description
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return &models.GameResponse{
+		Success:   true,
+		Narrative: "Você confere o que carrega:\n" + strings.Join(lines, "\n"),
+		State:     p.getCurrentState(caso, prog),
+	}
+}
+
+func pickedUpNarrative(caso *models.Case, added []string) string {
+	names := make([]string, 0, len(added))
+	for _, id := range added {
+		names = append(names, itemName(caso, id))
+	}
+	return fmt.Sprintf("\n\n[Adicionado ao inventário: %s]", strings.Join(names, ", "))
+}
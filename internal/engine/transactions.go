@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+)
+
+func isTransactionControl(stmt SQLStatement) bool {
+	return stmt.Kind == StmtBegin || stmt.Kind == StmtCommit || stmt.Kind == StmtRollback
+}
+
+// handleTransactionCommand trata BEGIN, COMMIT e ROLLBACK como comandos do
+// jogo. O sandbox é recriado a cada requisição, então a transação vive na
+// progressão: os comandos ficam em PendingSQL até serem confirmados.
+func (p *GameProcessor) handleTransactionCommand(
+	caso *models.Case,
+	progression *models.Progression,
+	s scriptStatement,
+) (*models.GameResponse, []models.SQLHistoryItem, error) {
+
+	switch s.Stmt.Kind {
+	case StmtBegin:
+		if progression.InTransaction {
+			return p.transactionError(caso, progression, "Já existe uma transação aberta. Use COMMIT para confirmar ou ROLLBACK para descartar as alterações pendentes.")
+		}
+		progression.InTransaction = true
+		progression.PendingSQL = nil
+
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: "Transação iniciada. As próximas alterações ficam pendentes até o COMMIT.",
+			State:     p.getCurrentState(caso, progression),
+		}, nil, nil
+
+	case StmtRollback:
+		if !progression.InTransaction {
+			return p.transactionError(caso, progression, "Não há transação aberta para desfazer. Use BEGIN para iniciar uma.")
+		}
+		if len(tokenizeSQL(s.SQL)) > 2 {
+			return p.transactionError(caso, progression, "Savepoints não são suportados. Use ROLLBACK para descartar toda a transação.")
+		}
+
+		discarded := len(progression.PendingSQL)
+		progression.InTransaction = false
+		progression.PendingSQL = nil
+
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: fmt.Sprintf("Transação desfeita. %d alteração(ões) pendente(s) descartada(s).", discarded),
+			State:     p.getCurrentState(caso, progression),
+		}, nil, nil
+
+	default:
+		if !progression.InTransaction {
+			return p.transactionError(caso, progression, "Não há transação aberta para confirmar. Use BEGIN para iniciar uma.")
+		}
+		return p.commitTransaction(caso, progression)
+	}
+}
+
+// commitTransaction devolve os comandos pendentes como novos itens do
+// histórico e só então roda as validações que podem liberar o próximo puzzle.
+func (p *GameProcessor) commitTransaction(
+	caso *models.Case,
+	progression *models.Progression,
+) (*models.GameResponse, []models.SQLHistoryItem, error) {
+
+	pending := progression.PendingSQL
+
+	if len(pending) == 0 {
+		progression.InTransaction = false
+		return &models.GameResponse{
+			Success:   true,
+			Narrative: "Transação confirmada. Não havia alterações pendentes.",
+			State:     p.getCurrentState(caso, progression),
+		}, nil, nil
+	}
+
+	dbInstance, err := p.openSandbox(caso, progression)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dbInstance.Close()
+
+	progression.InTransaction = false
+	progression.PendingSQL = nil
+
+	ctx, cancel := p.SQLiteFactory.CommandContext()
+	defer cancel()
+
+	if valRes, _ := p.runValidations(ctx, caso, progression, dbInstance, nil, len(pending), false); valRes != nil {
+		return valRes, pending, nil
+	}
+
+	return &models.GameResponse{
+		Success:   true,
+		Narrative: fmt.Sprintf("Transação confirmada. %d alteração(ões) gravada(s) no banco.", len(pending)),
+		State:     p.getCurrentState(caso, progression),
+	}, pending, nil
+}
+
+func (p *GameProcessor) transactionError(caso *models.Case, progression *models.Progression, message string) (*models.GameResponse, []models.SQLHistoryItem, error) {
+	return p.validationErrorResponse(caso, progression, models.APIError{
+		Message: message,
+		Code:    models.ErrTransactionState,
+	})
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestTransactionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+	}{
+		{"COMMIT sem BEGIN", []string{"COMMIT"}},
+		{"ROLLBACK sem BEGIN", []string{"ROLLBACK"}},
+		{"BEGIN duplo", []string{"BEGIN", "BEGIN TRANSACTION"}},
+		{"savepoint", []string{"BEGIN", "ROLLBACK TO sp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGame(t, testCase())
+			last := len(tt.commands) - 1
+			for _, command := range tt.commands[:last] {
+				g.mustRun(command)
+			}
+			resp := g.run(tt.commands[last])
+			if resp.Success || resp.ErrorCode != models.ErrTransactionState {
+				t.Errorf("%s: %+v", tt.commands[last], resp)
+			}
+		})
+	}
+}
+
+func TestRollbackReplaysCommittedHistory(t *testing.T) {
+	g := newTestGame(t, testCase())
+	g.mustRun("UPDATE suspeitos SET cargo = 'Gerente' WHERE id = 1")
+	g.mustRun("BEGIN")
+	g.mustRun("UPDATE suspeitos SET cargo = 'Sócia' WHERE id = 1")
+	g.mustRun("DELETE FROM suspeitos WHERE id = 3")
+
+	if got := g.column("SELECT cargo FROM suspeitos ORDER BY id"); !reflect.DeepEqual(got, []interface{}{"Sócia", "Chefe"}) {
+		t.Fatalf("dentro da transação: %v", got)
+	}
+	if len(g.prog.PendingSQL) != 2 || len(g.prog.SQLHistory) != 1 {
+		t.Fatalf("%d pendentes e %d no histórico, quer 2 e 1", len(g.prog.PendingSQL), len(g.prog.SQLHistory))
+	}
+
+	resp := g.mustRun("ROLLBACK")
+	if g.prog.InTransaction || g.prog.PendingSQL != nil {
+		t.Fatalf("ROLLBACK deixou a transação aberta: %+v", resp)
+	}
+
+	// sem os pendentes, o banco volta ao que o histórico confirmado produz
+	g.restart()
+	want := []interface{}{"Gerente", "Chefe", "Estagiária"}
+	if got := g.column("SELECT cargo FROM suspeitos ORDER BY id"); !reflect.DeepEqual(got, want) {
+		t.Errorf("depois do ROLLBACK: %v, quer %v", got, want)
+	}
+	if g.prog.Diverged {
+		t.Errorf("progressão divergente: %s", g.prog.Divergence.Reason)
+	}
+}
+
+func TestCommitUnlocksPuzzle(t *testing.T) {
+	g := newTestGame(t, testCase())
+	g.mustRun("BEGIN")
+
+	resp := g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'")
+	if g.prog.CurrentPuzzle != 1 || resp.Narrative == "Bruno foi preso." {
+		t.Fatalf("o puzzle avançou antes do COMMIT: %q", resp.Narrative)
+	}
+
+	resp = g.mustRun("COMMIT")
+	if resp.Narrative != "Bruno foi preso." || g.prog.CurrentPuzzle != 2 {
+		t.Errorf("COMMIT: %q no puzzle %d", resp.Narrative, g.prog.CurrentPuzzle)
+	}
+	if len(g.prog.SQLHistory) != 1 || g.prog.InTransaction {
+		t.Errorf("histórico com %d itens, transação aberta %v", len(g.prog.SQLHistory), g.prog.InTransaction)
+	}
+}
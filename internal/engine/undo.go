@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"fmt"
+	"strconv"
+)
+
+// handleUndo remove os últimos n comandos do histórico sem nunca passar do
+// checkpoint do puzzle atual nem de um comando de outro puzzle. A gravação
+// no Mongo fica com o handler, que usa o resumo em Undo para truncar o
+// histórico de forma atômica.
+func (p *GameProcessor) handleUndo(caso *models.Case, progression *models.Progression, args []string) *models.GameResponse {
+	undoError := func(message string) *models.GameResponse {
+		return &models.GameResponse{
+			Success:   false,
+			Error:     message,
+			ErrorCode: models.ErrUndoUnavailable,
+			State:     p.getCurrentState(caso, progression),
+		}
+	}
+
+	count := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || len(args) > 1 {
+			return undoError("Use DESFAZER ou DESFAZER <n>, onde n é o número de comandos a desfazer.")
+		}
+		count = n
+	}
+
+	if progression.InTransaction {
+		return undoError("Há uma transação aberta. Use ROLLBACK para descartar as alterações pendentes.")
+	}
+
+	checkpoint := p.getPuzzleCheckpoint(progression, progression.CurrentPuzzle)
+	if checkpoint < 0 || checkpoint > len(progression.SQLHistory) {
+		checkpoint = len(progression.SQLHistory)
+	}
+
+	// só os comandos do puzzle atual no fim do histórico: com puzzles em
+	// paralelo, os de outra frente podem vir depois do checkpoint
+	available := 0
+	for i := len(progression.SQLHistory) - 1; i >= checkpoint; i-- {
+		if progression.SQLHistory[i].PuzzleState != progression.CurrentPuzzle {
+			break
+		}
+		available++
+	}
+	if available == 0 {
+		if otherPuzzleAfter(progression, checkpoint) {
+			return undoError("Os últimos comandos são de outro puzzle. Volte a ele com PUZZLE <n> para desfazê-los.")
+		}
+		return undoError("Não há comandos para desfazer neste puzzle.")
+	}
+	if count > available {
+		count = available
+	}
+
+	keep := len(progression.SQLHistory) - count
+	undone := make([]string, 0, count)
+	for i := len(progression.SQLHistory) - 1; i >= keep; i-- {
+		undone = append(undone, progression.SQLHistory[i].Query)
+	}
+
+	progression.SQLHistory = progression.SQLHistory[:keep]
+
+	return &models.GameResponse{
+		Success:   true,
+		Narrative: fmt.Sprintf("%d comando(s) desfeito(s). O banco volta ao estado anterior a eles.", count),
+		Undo: &models.UndoSummary{
+			Count:      count,
+			Statements: undone,
+			Remaining:  available - count,
+		},
+		State: p.getCurrentState(caso, progression),
+	}
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestUndoLimits(t *testing.T) {
+	g := newTestGame(t, testCase())
+	g.mustRun("UPDATE suspeitos SET cargo = 'A' WHERE id = 1")
+	g.mustRun("UPDATE suspeitos SET cargo = 'B' WHERE id = 1")
+	g.mustRun("UPDATE suspeitos SET cargo = 'C' WHERE id = 1")
+	g.mustRun("SELECT * FROM suspeitos")
+
+	tests := []struct {
+		command   string
+		success   bool
+		undone    int
+		remaining int
+		history   int
+	}{
+		{"DESFAZER 0", false, 0, 0, 3},
+		{"DESFAZER dois", false, 0, 0, 3},
+		{"DESFAZER 1 2", false, 0, 0, 3},
+		{"DESFAZER", true, 1, 2, 2},
+		{"UNDO 5", true, 2, 0, 0},
+		{"DESFAZER", false, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		resp := g.run(tt.command)
+		if resp.Success != tt.success {
+			t.Fatalf("%s: Success = %v, quer %v (%s)", tt.command, resp.Success, tt.success, resp.Error)
+		}
+		if !tt.success {
+			if resp.ErrorCode != models.ErrUndoUnavailable {
+				t.Errorf("%s: ErrorCode = %s", tt.command, resp.ErrorCode)
+			}
+		} else if resp.Undo.Count != tt.undone || resp.Undo.Remaining != tt.remaining {
+			t.Errorf("%s: Undo = %+v, quer %d desfeitos e %d restantes", tt.command, resp.Undo, tt.undone, tt.remaining)
+		}
+		if len(g.prog.SQLHistory) != tt.history {
+			t.Fatalf("%s: histórico com %d itens, quer %d", tt.command, len(g.prog.SQLHistory), tt.history)
+		}
+	}
+
+	if got := g.column("SELECT cargo FROM suspeitos WHERE id = 1"); !reflect.DeepEqual(got, []interface{}{"Analista"}) {
+		t.Errorf("cargo = %v, quer Analista", got)
+	}
+}
+
+func TestUndoStopsAtCheckpoint(t *testing.T) {
+	g := newTestGame(t, testCase())
+	g.mustRun("UPDATE suspeitos SET cargo = 'A' WHERE id = 1")
+	g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'")
+	if g.prog.CurrentPuzzle != 2 {
+		t.Fatalf("puzzle %d, quer 2", g.prog.CurrentPuzzle)
+	}
+
+	if resp := g.run("DESFAZER"); resp.Success {
+		t.Fatal("DESFAZER não pode voltar ao puzzle anterior")
+	}
+
+	g.mustRun("DELETE FROM pistas WHERE id = 1")
+	resp := g.mustRun("DESFAZER 3")
+	if resp.Undo.Count != 1 || len(g.prog.SQLHistory) != 2 {
+		t.Errorf("Undo = %+v com %d itens no histórico", resp.Undo, len(g.prog.SQLHistory))
+	}
+}
+
+func TestUndoInTransaction(t *testing.T) {
+	g := newTestGame(t, testCase())
+	g.mustRun("UPDATE suspeitos SET cargo = 'A' WHERE id = 1")
+	g.mustRun("BEGIN")
+	if resp := g.run("DESFAZER"); resp.Success || resp.ErrorCode != models.ErrUndoUnavailable {
+		t.Fatalf("DESFAZER com transação aberta: %+v", resp)
+	}
+}
+
+// Com puzzles em paralelo, DESFAZER não passa por cima dos comandos de outra
+// frente que vieram depois do checkpoint.
+func TestUndoKeepsOtherPuzzles(t *testing.T) {
+	g := newTestGame(t, graphCase())
+	g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Bruno'")
+	g.mustRun("INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'p2')")
+	g.mustRun("PUZZLE 3")
+	g.mustRun("INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'p3a')")
+	g.mustRun("INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'p3b')")
+	g.mustRun("PUZZLE 2")
+
+	resp := g.run("DESFAZER 5")
+	if resp.Success || resp.ErrorCode != models.ErrUndoUnavailable {
+		t.Fatalf("DESFAZER sobre comandos do puzzle 3: %+v", resp)
+	}
+
+	g.mustRun("INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'p2b')")
+	resp = g.mustRun("DESFAZER 5")
+	if resp.Undo.Count != 1 || !reflect.DeepEqual(resp.Undo.Statements, []string{"INSERT INTO pistas (suspeito_id, descricao) VALUES (1, 'p2b')"}) {
+		t.Errorf("Undo = %+v, quer só o INSERT de p2b", resp.Undo)
+	}
+
+	got := g.column("SELECT descricao FROM pistas ORDER BY id")
+	if want := []interface{}{"cabelo", "pegada", "p2", "p3a", "p3b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pistas = %v, quer %v", got, want)
+	}
+
+	g.mustRun("PUZZLE 3")
+	if resp := g.mustRun("DESFAZER 5"); resp.Undo.Count != 2 {
+		t.Errorf("no puzzle 3, Undo = %+v, quer 2 desfeitos", resp.Undo)
+	}
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type groupOutcome struct {
+	group    []models.Validation
+	kind     string
+	passed   bool
+	skipped  bool
+	unmet    []string
+	feedback *models.ResultFeedback
+}
+
+// validationGroups agrupa as validações do puzzle preservando a ordem do
+// caso: cada grupo fica na posição da sua primeira validação.
+func validationGroups(validations []models.Validation, puzzle int) [][]models.Validation {
+	groups := make([][]models.Validation, 0)
+	index := map[string]int{}
+
+	for _, v := range validations {
+		if v.Puzzle != puzzle {
+			continue
+		}
+		if v.Group == "" {
+			groups = append(groups, []models.Validation{v})
+			continue
+		}
+		if i, ok := index[v.Group]; ok {
+			groups[i] = append(groups[i], v)
+			continue
+		}
+		index[v.Group] = len(groups)
+		groups = append(groups, []models.Validation{v})
+	}
+
+	return groups
+}
+
+func (p *GameProcessor) evaluateGroup(ctx context.Context, dbInstance *db.Sandbox, group []models.Validation, lastData interface{}, now time.Time) groupOutcome {
+	outcome := groupOutcome{group: group, kind: group[0].Type, passed: true}
+
+	for i, v := range group {
+		var passed bool
+
+		// result_check sem reference_sql cai na checagem por CheckSQL, como
+		// nos casos anteriores ao tipo
+		if v.Type == validationResultCheck && v.ReferenceSQL != "" {
+			outcome.kind = validationResultCheck
+			result, ok := lastData.(models.QueryResult)
+			if !ok {
+				// só um SELECT do jogador pode ser comparado à referência
+				outcome.skipped = true
+				return outcome
+			}
+			var feedback *models.ResultFeedback
+			passed, feedback = p.matchesReference(ctx, dbInstance, result, v, now)
+			if outcome.feedback == nil {
+				outcome.feedback = feedback
+			}
+		} else {
+			var value interface{}
+			err := dbInstance.Trusted(func() error {
+				return dbInstance.QueryRowContext(ctx, applyWorldClock(v.CheckSQL, now)).Scan(&value)
+			})
+			passed = err == nil && expectationMet(v, value)
+		}
+
+		if !passed {
+			outcome.passed = false
+			if v.Label != "" || len(group) > 1 {
+				outcome.unmet = append(outcome.unmet, validationLabel(v, i))
+			}
+		}
+	}
+
+	return outcome
+}
+
+func validationLabel(v models.Validation, i int) string {
+	if v.Label != "" {
+		return v.Label
+	}
+	return fmt.Sprintf("condição %d", i+1)
+}
+
+func expectationMet(v models.Validation, value interface{}) bool {
+	switch strings.ToLower(strings.TrimSpace(v.Operator)) {
+	case "", "=", "==":
+		return valuesEqual(value, v.ExpectValue)
+	case "!=", "<>":
+		return !valuesEqual(value, v.ExpectValue)
+	case ">":
+		return value != nil && compareValue(value, v.ExpectValue) > 0
+	case ">=":
+		return value != nil && compareValue(value, v.ExpectValue) >= 0
+	case "<":
+		return value != nil && compareValue(value, v.ExpectValue) < 0
+	case "<=":
+		return value != nil && compareValue(value, v.ExpectValue) <= 0
+	case "between":
+		if len(v.ExpectValues) != 2 || value == nil {
+			return false
+		}
+		return compareValue(value, v.ExpectValues[0]) >= 0 && compareValue(value, v.ExpectValues[1]) <= 0
+	case "in":
+		for _, expected := range v.ExpectValues {
+			if valuesEqual(value, expected) {
+				return true
+			}
+		}
+		return false
+	case "regex":
+		re, err := regexp.Compile(v.ExpectValue)
+		if err != nil {
+			log.Printf("Aviso: Regex inválida na validação do puzzle %d: %v", v.Puzzle, err)
+			return false
+		}
+		return value != nil && re.MatchString(valueString(value))
+	case "null":
+		return value == nil
+	default:
+		log.Printf("Aviso: Operador de validação desconhecido: %q", v.Operator)
+		return false
+	}
+}
+
+// valuesEqual mantém a comparação textual original e aceita também números
+// iguais escritos de outra forma ("1" e 1.0).
+func valuesEqual(value interface{}, expected string) bool {
+	if fmt.Sprintf("%v", value) == expected {
+		return true
+	}
+	a, aNum := numericValue(value)
+	b, err := strconv.ParseFloat(strings.TrimSpace(expected), 64)
+	return aNum && err == nil && a == b
+}
+
+// compareValue compara numericamente quando possível e, senão, como texto.
+func compareValue(value interface{}, expected string) int {
+	if a, ok := numericValue(value); ok {
+		if b, err := strconv.ParseFloat(strings.TrimSpace(expected), 64); err == nil {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(valueString(value), expected)
+}
+
+func valueString(value interface{}) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"casos-de-codigo-api/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestExpectationMet(t *testing.T) {
+	tests := []struct {
+		operator string
+		expect   string
+		values   []string
+		value    interface{}
+		want     bool
+	}{
+		{"", "3", nil, int64(3), true},
+		{"=", "3", nil, 3.0, true},
+		{"==", "3.0", nil, int64(3), true},
+		{"=", "Ana", nil, "Ana", true},
+		{"=", "ana", nil, "Ana", false},
+		{"!=", "3", nil, int64(4), true},
+		{"<>", "3", nil, int64(3), false},
+		{">", "10", nil, int64(9), false},
+		{">", "10", nil, int64(11), true},
+		{">=", "10", nil, 10.0, true},
+		{"<", "2", nil, int64(10), false},
+		{"<=", "b", nil, "a", true},
+		{">", "1", nil, nil, false},
+		{"BETWEEN", "", []string{"2", "5"}, int64(5), true},
+		{"between", "", []string{"2", "5"}, int64(6), false},
+		{"between", "", []string{"2"}, int64(3), false},
+		{"in", "", []string{"Ana", "Bruno"}, "Bruno", true},
+		{"in", "", []string{"1", "2"}, 2.0, true},
+		{"in", "", []string{"Ana"}, "Carla", false},
+		{"regex", "^B", nil, "Bruno", true},
+		{"regex", "^B", nil, []byte("Ana"), false},
+		{"regex", "(", nil, "(", false},
+		{"null", "", nil, nil, true},
+		{"null", "", nil, int64(0), false},
+		{"parecido", "x", nil, "x", false},
+	}
+
+	for _, tt := range tests {
+		v := models.Validation{Operator: tt.operator, ExpectValue: tt.expect, ExpectValues: tt.values}
+		if got := expectationMet(v, tt.value); got != tt.want {
+			t.Errorf("%s %q %v com %v = %v, quer %v", tt.operator, tt.expect, tt.values, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidationGroups(t *testing.T) {
+	validations := []models.Validation{
+		{Puzzle: 1, Label: "a", Group: "g1"},
+		{Puzzle: 1, Label: "b"},
+		{Puzzle: 2, Label: "outro puzzle", Group: "g1"},
+		{Puzzle: 1, Label: "c", Group: "g1"},
+		{Puzzle: 1, Label: "d", Group: "g2"},
+	}
+
+	var got [][]string
+	for _, group := range validationGroups(validations, 1) {
+		labels := make([]string, 0, len(group))
+		for _, v := range group {
+			labels = append(labels, v.Label)
+		}
+		got = append(got, labels)
+	}
+
+	if want := [][]string{{"a", "c"}, {"b"}, {"d"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("validationGroups = %v, quer %v", got, want)
+	}
+}
+
+// o grupo só passa com todas as condições; sem grupo satisfeito, o primeiro
+// com failure_narrative lista as pendentes
+func TestGroupedValidations(t *testing.T) {
+	caso := testCase()
+	caso.Validations = []models.Validation{
+		{
+			Puzzle: 1, Group: "prisao", Label: "Bruno preso",
+			CheckSQL: "SELECT preso FROM suspeitos WHERE nome = 'Bruno'", ExpectValue: "1",
+			SuccessNarrative: "Caso fechado.", FailureNarrative: "Ainda falta algo.",
+			UnlocksNext: true, NextPuzzle: 2,
+		},
+		{
+			Puzzle: 1, Group: "prisao", Label: "Ana solta",
+			CheckSQL: "SELECT preso FROM suspeitos WHERE nome = 'Ana'", Operator: "in", ExpectValues: []string{"0"},
+		},
+		{
+			Puzzle: 1, Label: "todos presos",
+			CheckSQL: "SELECT COUNT(*) FROM suspeitos WHERE preso = 1", Operator: ">=", ExpectValue: "3",
+			SuccessNarrative: "Prendeu todo mundo.",
+		},
+	}
+	g := newTestGame(t, caso)
+
+	resp := g.mustRun("UPDATE suspeitos SET preso = 1 WHERE nome = 'Ana'")
+	if resp.Narrative != "Ainda falta algo." || !reflect.DeepEqual(resp.Unmet, []string{"Bruno preso", "Ana solta"}) {
+		t.Errorf("resposta = %q, pendentes %v", resp.Narrative, resp.Unmet)
+	}
+
+	resp = g.mustRun("UPDATE suspeitos SET preso = 1")
+	if resp.Narrative != "Prendeu todo mundo." || g.prog.CurrentPuzzle != 1 {
+		t.Errorf("resposta = %q no puzzle %d", resp.Narrative, g.prog.CurrentPuzzle)
+	}
+
+	resp = g.mustRun("UPDATE suspeitos SET preso = 0 WHERE nome <> 'Bruno'")
+	if resp.Narrative != "Caso fechado." || g.prog.CurrentPuzzle != 2 {
+		t.Errorf("resposta = %q no puzzle %d", resp.Narrative, g.prog.CurrentPuzzle)
+	}
+}
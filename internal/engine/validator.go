@@ -15,9 +15,15 @@ func (v *Validator) ValidateSQLCommand(caso *models.Case, progression *models.Pr
 	upper := strings.ToUpper(command)
 
 	for _, req := range caso.FocusRequirements {
-		if req.Puzzle == progression.CurrentPuzzle {
+		condition := req.CompiledCondition()
+		if req.Puzzle == progression.CurrentPuzzle || (req.Puzzle == 0 && condition != nil) {
+			// o foco exigido pode ser o atual ou qualquer objeto que o contenha
+			satisfied := strings.EqualFold(progression.CurrentFocus, req.RequiredFocus) || progression.InFocus(req.RequiredFocus)
+			if condition != nil {
+				satisfied = condition.Eval(progressionState{progression})
+			}
 			for _, cmdType := range req.CommandTypes {
-				if strings.Contains(upper, cmdType) && !strings.EqualFold(progression.CurrentFocus, req.RequiredFocus) {
+				if strings.Contains(upper, cmdType) && !satisfied {
 					return models.APIError{
 						Message: req.ErrorMessage,
 						Code:    models.ErrFocusRequired,
@@ -30,6 +36,22 @@ func (v *Validator) ValidateSQLCommand(caso *models.Case, progression *models.Pr
 	return nil
 }
 
+func (v *Validator) ValidateStatement(caso *models.Case, progression *models.Progression, stmt SQLStatement) error {
+	if !stmt.IsSQL() {
+		return nil
+	}
+
+	puzzle := findPuzzle(caso, progression.CurrentPuzzle)
+	if !statementAllowed(puzzle, stmt) {
+		return models.APIError{
+			Message: statementDeniedMessage(puzzle, stmt),
+			Code:    models.ErrStatementDenied,
+		}
+	}
+
+	return nil
+}
+
 func (v *Validator) IsValidCase(caso *models.Case) bool {
 	if caso.ID == "" || caso.Title == "" {
 		return false
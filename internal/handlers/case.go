@@ -5,6 +5,7 @@ import (
 	"casos-de-codigo-api/internal/db"
 	"casos-de-codigo-api/internal/models"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -20,6 +21,26 @@ func NewCaseHandler(mongo *db.MongoManager) *CaseHandler {
 	}
 }
 
+// writeCaseError responde a uma falha ao carregar o caso. Condições
+// inválidas são erro do autor e vêm listadas, para serem corrigidas.
+func writeCaseError(w http.ResponseWriter, err error) {
+	var compileErr *db.CaseCompileError
+	if !errors.As(err, &compileErr) {
+		http.Error(w, `{"error": "Caso não encontrado"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Error   string   `json:"error"`
+		Details []string `json:"details"`
+	}{
+		Error:   "O caso tem condições inválidas e não pode ser carregado.",
+		Details: compileErr.Details(),
+	})
+}
+
 func (h *CaseHandler) GetAllCases(w http.ResponseWriter, r *http.Request) {
 	cases, err := h.MongoManager.GetAllCases()
 	if err != nil {
@@ -69,7 +90,7 @@ func (h *CaseHandler) GetCase(w http.ResponseWriter, r *http.Request) {
 
 	caso, err := h.MongoManager.GetCase(caseID)
 	if err != nil {
-		http.Error(w, `{"error": "Caso não encontrado"}`, http.StatusNotFound)
+		writeCaseError(w, err)
 		return
 	}
 
@@ -112,7 +133,7 @@ func (h *CaseHandler) InitializeCase(w http.ResponseWriter, r *http.Request) {
 
 	caso, err := h.MongoManager.GetCase(req.CaseID)
 	if err != nil {
-		http.Error(w, `{"error": "Caso não encontrado"}`, http.StatusNotFound)
+		writeCaseError(w, err)
 		return
 	}
 
@@ -40,7 +40,7 @@ func (h *GameHandler) ExecuteCommand(w http.ResponseWriter, r *http.Request) {
 
 	caso, err := h.MongoManager.GetCase(req.CaseID)
 	if err != nil {
-		http.Error(w, `{"error": "Caso não encontrado"}`, http.StatusNotFound)
+		writeCaseError(w, err)
 		return
 	}
 
@@ -80,7 +80,12 @@ func (h *GameHandler) ExecuteCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, historyItem, err := h.GameProcessor.ProcessCommand(caso, progression, req.SQL)
+	wasDiverged := progression.Diverged
+	wasCompleted := progression.CompletedAt != nil
+	response, historyItems, statements, err := h.GameProcessor.ProcessCommand(caso, progression, req.SQL)
+	if progression.Diverged && !wasDiverged {
+		_ = h.MongoManager.MarkDiverged(userID, req.CaseID, progression.Divergence)
+	}
 
 	event := &models.TelemetryEvent{
 		UserID: userID,
@@ -89,56 +94,29 @@ func (h *GameHandler) ExecuteCommand(w http.ResponseWriter, r *http.Request) {
 
 		Timestamp: time.Now(),
 
-		InputType: func() string {
-			cmd := strings.ToUpper(strings.TrimSpace(req.SQL))
-			if strings.HasPrefix(cmd, "SELECT") ||
-				strings.HasPrefix(cmd, "UPDATE") ||
-				strings.HasPrefix(cmd, "INSERT") ||
-				strings.HasPrefix(cmd, "DELETE") {
-				return "sql"
-			}
-			return "game_command"
-		}(),
-
-		Query: func() string {
-			cmd := strings.ToUpper(strings.TrimSpace(req.SQL))
-			if strings.HasPrefix(cmd, "SELECT") ||
-				strings.HasPrefix(cmd, "UPDATE") ||
-				strings.HasPrefix(cmd, "INSERT") ||
-				strings.HasPrefix(cmd, "DELETE") {
-				return req.SQL
-			}
-			return ""
-		}(),
-
-		Command: func() string {
-			cmd := strings.ToUpper(strings.TrimSpace(req.SQL))
-			if strings.HasPrefix(cmd, "SELECT") ||
-				strings.HasPrefix(cmd, "UPDATE") ||
-				strings.HasPrefix(cmd, "INSERT") ||
-				strings.HasPrefix(cmd, "DELETE") {
-				return ""
-			}
-			return req.SQL
-		}(),
+		InputType: "game_command",
+		Command:   req.SQL,
 
 		FocusState: progression.CurrentFocus,
 
-		Result: models.TelemetryResult{
-			Status: func() string {
-				if response.Success {
-					return "success"
-				}
-				return "error"
-			}(),
-			ErrorType: func() string {
-				if response.Success {
-					return ""
-				}
-				return "execution"
-			}(),
-			DBChanged: historyItem != nil,
-		},
+		Result: telemetryResult(response, err, len(historyItems) > 0),
+	}
+
+	if response != nil && response.Hint != nil {
+		event.InputType = "hint"
+		event.Hint = &models.TelemetryHint{
+			Tier:    response.Hint.Tier,
+			Total:   response.Hint.Total,
+			Penalty: response.Hint.Penalty,
+			New:     response.Hint.New,
+		}
+	}
+
+	if len(statements) > 0 {
+		event.InputType = "sql"
+		event.Query = req.SQL
+		event.Command = ""
+		describeStatements(event, statements)
 	}
 
 	_ = h.MongoManager.SaveTelemetry(event)
@@ -152,14 +130,56 @@ func (h *GameHandler) ExecuteCommand(w http.ResponseWriter, r *http.Request) {
 		progression.CurrentPuzzle = response.State.CurrentPuzzle
 		progression.CurrentFocus = response.State.CurrentFocus
 
-		if progression.CurrentPuzzle >= len(caso.Puzzles) {
-			progression.Completed = true
+		if response.Undo != nil {
+			keep := len(progression.SQLHistory)
+			err := h.MongoManager.TruncateSQLHistory(userID, req.CaseID, keep+response.Undo.Count, keep)
+			if err != nil && err != db.ErrHistoryChanged {
+				http.Error(w, `{"error": "Erro interno"}`, http.StatusInternalServerError)
+				return
+			}
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(models.GameResponse{
+					Success:   false,
+					Error:     "O histórico mudou enquanto o comando era processado. Tente desfazer novamente.",
+					ErrorCode: models.ErrHistoryConflict,
+				})
+				return
+			}
+		} else {
+			_ = h.MongoManager.UpsertProgression(progression)
 		}
 
-		_ = h.MongoManager.UpsertProgression(progression)
+		if len(historyItems) > 0 && !response.IsDebug {
+			_ = h.MongoManager.AddSQLHistory(userID, req.CaseID, historyItems...)
+		}
+
+		if !wasCompleted && progression.CompletedAt != nil {
+			score := engine.ComputeScore(caso, progression)
+			score.Guest = auth.IsGuest(r.Context())
+			score.DisplayName, score.Public = leaderboardIdentity(h.MongoManager, userID, score.Guest)
+			_ = h.MongoManager.SaveScore(score)
+			response.Score = score
+		}
+	} else if len(statements) > 0 {
+		_ = h.MongoManager.RecordFailedAttempt(userID, req.CaseID, progression.CurrentPuzzle)
+	}
+
+	if progression.Divergence != nil {
+		notice := *progression.Divergence
+		notice.RepairOptions = h.GameProcessor.RepairOptions(progression)
+		response.Divergence = &notice
+	}
 
-		if historyItem != nil && historyItem.Query != "RESET_CASE" && !response.IsDebug {
-			_ = h.MongoManager.AddSQLHistory(userID, req.CaseID, *historyItem)
+	if req.ResultFormat == models.ResultFormatMap {
+		if result, ok := response.Data.(models.QueryResult); ok {
+			response.Data = result.Legacy()
+		}
+		for i := range response.Statements {
+			if result, ok := response.Statements[i].Data.(models.QueryResult); ok {
+				response.Statements[i].Data = result.Legacy()
+			}
 		}
 	}
 
@@ -170,6 +190,110 @@ func (h *GameHandler) ExecuteCommand(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// RepairProgression descarta a parte divergente do histórico da progressão,
+// voltando ao último comando consistente ou ao checkpoint do puzzle atual.
+func (h *GameHandler) RepairProgression(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error": "Não autorizado"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req models.RepairRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Requisição inválida"}`, http.StatusBadRequest)
+		return
+	}
+
+	caso, err := h.MongoManager.GetCase(req.CaseID)
+	if err != nil {
+		writeCaseError(w, err)
+		return
+	}
+
+	progression, err := h.MongoManager.GetProgression(userID, req.CaseID)
+	if err != nil {
+		http.Error(w, `{"error": "Erro ao buscar progresso"}`, http.StatusInternalServerError)
+		return
+	}
+	if progression == nil {
+		http.Error(w, `{"error": "Progresso não encontrado"}`, http.StatusNotFound)
+		return
+	}
+
+	expectedLen := len(progression.SQLHistory)
+	response, err := h.GameProcessor.RepairProgression(caso, progression, req.Mode)
+	if err != nil {
+		http.Error(w, `{"error": "Erro interno"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !response.Success {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := h.MongoManager.SaveRepairedProgression(progression, expectedLen); err != nil {
+		if err != db.ErrHistoryChanged {
+			http.Error(w, `{"error": "Erro interno"}`, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(models.GameResponse{
+			Success:   false,
+			Error:     "O histórico mudou enquanto o reparo era processado. Tente novamente.",
+			ErrorCode: models.ErrHistoryConflict,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// describeStatements preenche o tipo e as tabelas do evento. Um script
+// aparece como "script", com o tipo de cada comando em StatementKinds e as
+// tabelas de todos eles.
+func describeStatements(event *models.TelemetryEvent, statements []engine.SQLStatement) {
+	event.StatementKind = string(statements[0].Kind)
+	if len(statements) > 1 {
+		event.StatementKind = "script"
+		event.StatementKinds = make([]string, 0, len(statements))
+	}
+
+	seen := map[string]bool{}
+	for _, s := range statements {
+		if len(statements) > 1 {
+			event.StatementKinds = append(event.StatementKinds, string(s.Kind))
+		}
+		for _, table := range s.Tables {
+			if !seen[table] {
+				seen[table] = true
+				event.Tables = append(event.Tables, table)
+			}
+		}
+	}
+}
+
+// telemetryResult resume o resultado do comando; com erro interno não há
+// resposta do processador para consultar.
+func telemetryResult(response *models.GameResponse, err error, dbChanged bool) models.TelemetryResult {
+	if err != nil || response == nil {
+		return models.TelemetryResult{Status: "error", ErrorType: "internal"}
+	}
+	if response.Success {
+		return models.TelemetryResult{Status: "success", DBChanged: dbChanged}
+	}
+
+	errorType := response.ErrorClass
+	if errorType == "" {
+		errorType = models.ErrorClassExecution
+	}
+	return models.TelemetryResult{Status: "error", ErrorType: errorType, DBChanged: dbChanged}
+}
+
 func (h *GameHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"casos-de-codigo-api/internal/auth"
+	"casos-de-codigo-api/internal/db"
+	"casos-de-codigo-api/internal/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultLeaderboardPageSize = 20
+	maxLeaderboardPageSize     = 100
+	maxLeaderboardPage         = 1000
+	maxDisplayNameLength       = 30
+)
+
+type LeaderboardHandler struct {
+	MongoManager *db.MongoManager
+}
+
+func NewLeaderboardHandler(mongo *db.MongoManager) *LeaderboardHandler {
+	return &LeaderboardHandler{
+		MongoManager: mongo,
+	}
+}
+
+func (h *LeaderboardHandler) GetGlobal(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := pagination(r)
+	entries, total, err := h.MongoManager.GlobalLeaderboard(page, pageSize)
+	if err != nil {
+		http.Error(w, `{"error": "Erro ao buscar ranking"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.LeaderboardPage{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		Entries:  entries,
+	})
+}
+
+func (h *LeaderboardHandler) GetCase(w http.ResponseWriter, r *http.Request) {
+	caseID := mux.Vars(r)["id"]
+	if _, err := h.MongoManager.GetCase(caseID); err != nil {
+		writeCaseError(w, err)
+		return
+	}
+
+	page, pageSize := pagination(r)
+	entries, total, err := h.MongoManager.CaseLeaderboard(caseID, page, pageSize)
+	if err != nil {
+		http.Error(w, `{"error": "Erro ao buscar ranking"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.LeaderboardPage{
+		CaseID:   caseID,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		Entries:  entries,
+	})
+}
+
+// OptIn liga ou desliga a participação do jogador nos rankings. É o único
+// jeito de um convidado aparecer neles.
+func (h *LeaderboardHandler) OptIn(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error": "Não autorizado"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req models.LeaderboardOptInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Requisição inválida"}`, http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(req.DisplayName)
+	if len([]rune(name)) > maxDisplayNameLength {
+		http.Error(w, `{"error": "Nome de exibição muito longo"}`, http.StatusBadRequest)
+		return
+	}
+	// usuários registrados aparecem sempre com o próprio username
+	if !auth.IsGuest(r.Context()) {
+		name = ""
+	}
+
+	prefs := &models.LeaderboardPrefs{UserID: userID, OptIn: req.OptIn, DisplayName: name}
+	if err := h.MongoManager.SaveLeaderboardPrefs(prefs); err != nil {
+		http.Error(w, `{"error": "Erro ao salvar preferência"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		OptIn       bool   `json:"opt_in"`
+		DisplayName string `json:"display_name"`
+	}{
+		OptIn:       prefs.OptIn,
+		DisplayName: displayName(h.MongoManager, userID, auth.IsGuest(r.Context()), prefs),
+	})
+}
+
+// leaderboardIdentity decide o nome e a visibilidade de uma pontuação nova.
+func leaderboardIdentity(mongo *db.MongoManager, userID primitive.ObjectID, guest bool) (string, bool) {
+	prefs, _ := mongo.GetLeaderboardPrefs(userID)
+	public := !guest
+	if prefs != nil {
+		public = prefs.OptIn
+	}
+	return displayName(mongo, userID, guest, prefs), public
+}
+
+func displayName(mongo *db.MongoManager, userID primitive.ObjectID, guest bool, prefs *models.LeaderboardPrefs) string {
+	if !guest {
+		if user, err := mongo.FindUserByID(userID); err == nil && user != nil {
+			return user.Username
+		}
+	}
+	if prefs != nil && prefs.DisplayName != "" {
+		return prefs.DisplayName
+	}
+	hex := userID.Hex()
+	return "Detetive " + strings.ToUpper(hex[len(hex)-4:])
+}
+
+func pagination(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	// evita que (page-1)*pageSize estoure o int e vire um skip negativo
+	if page > maxLeaderboardPage {
+		page = maxLeaderboardPage
+	}
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultLeaderboardPageSize
+	}
+	if pageSize > maxLeaderboardPageSize {
+		pageSize = maxLeaderboardPageSize
+	}
+	return page, pageSize
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"casos-de-codigo-api/internal/conditions"
+	"fmt"
+	"log"
+	"time"
+)
 
 type Case struct {
 	ID                string             `bson:"_id" json:"id"`
@@ -19,6 +24,15 @@ type Case struct {
 	FocusRequirements []FocusRequirement `bson:"focus_requirements" json:"focus_requirements"`
 	SQLFunctions      []SQLFunction      `bson:"sql_functions" json:"sql_functions"`
 	HelpTexts         []HelpText         `bson:"help_texts" json:"help_texts"`
+	Items             []CaseItem         `bson:"items,omitempty" json:"items,omitempty"`
+	Endings           []Ending           `bson:"endings,omitempty" json:"endings,omitempty"`
+	Accusation        *Accusation        `bson:"accusation,omitempty" json:"-"`
+
+	// SandboxClock é o instante que o motor gravou no schema no lugar de
+	// CURRENT_TIMESTAMP e afins; vazio quando o schema não usa o relógio.
+	SandboxClock string `bson:"-" json:"-"`
+
+	conditionsCompiled bool
 }
 
 type CaseSummary struct {
@@ -31,6 +45,15 @@ type CaseSummary struct {
 type CaseConfig struct {
 	StartingPuzzle int      `bson:"starting_puzzle" json:"starting_puzzle"`
 	Interactables  []string `bson:"interactables" json:"interactables"`
+	// ObjectParents diz dentro de qual objeto cada objeto está (ex:
+	// "gaveta": "mesa"). Um objeto com pai só pode ser examinado com o pai
+	// na pilha de foco; objetos sem pai estão sempre ao alcance.
+	ObjectParents map[string]string `bson:"object_parents,omitempty" json:"object_parents,omitempty"`
+	// WorldTime é o "agora" da história (ex: "2023-10-12 23:40:00"), usado
+	// no lugar do relógio real por date('now') e CURRENT_TIMESTAMP.
+	WorldTime string `bson:"world_time,omitempty" json:"world_time,omitempty"`
+	// Scoring substitui os pesos de DefaultScoring.
+	Scoring *ScoringConfig `bson:"scoring,omitempty" json:"scoring,omitempty"`
 }
 
 type Puzzle struct {
@@ -39,6 +62,35 @@ type Puzzle struct {
 	ImageKey  string   `bson:"image_key,omitempty" json:"image_key,omitempty"`
 	Tables    []string `bson:"tables" json:"tables"`
 	Commands  []string `bson:"commands" json:"commands"`
+
+	AllowedStatements      []string `bson:"allowed_statements,omitempty" json:"allowed_statements,omitempty"`
+	AllowedTables          []string `bson:"allowed_tables,omitempty" json:"allowed_tables,omitempty"`
+	StatementDeniedMessage string   `bson:"statement_denied_message,omitempty" json:"statement_denied_message,omitempty"`
+	TableDeniedMessage     string   `bson:"table_denied_message,omitempty" json:"table_denied_message,omitempty"`
+
+	// Prerequisites lista os puzzles que precisam estar resolvidos para este
+	// ser aberto; sem pré-requisitos, o puzzle está disponível desde o
+	// início. Um puzzle com Ending é terminal: chegar a ele encerra o caso.
+	Prerequisites []int  `bson:"prerequisites,omitempty" json:"prerequisites,omitempty"`
+	Ending        string `bson:"ending,omitempty" json:"ending,omitempty"`
+
+	// Hints são reveladas uma por vez pelo DICA, da mais vaga à mais
+	// próxima da solução; não vão para o cliente junto com o caso.
+	Hints []Hint `bson:"hints,omitempty" json:"-"`
+}
+
+// Hint é um nível de dica de um puzzle. Penalty é descontado da pontuação
+// do puzzle quando a dica é usada; sem ele vale o hint_penalty do scoring.
+type Hint struct {
+	Text    string `bson:"text" json:"text"`
+	Penalty int    `bson:"penalty,omitempty" json:"penalty,omitempty"`
+}
+
+type Ending struct {
+	ID        string `bson:"id" json:"id"`
+	Title     string `bson:"title" json:"title"`
+	Narrative string `bson:"narrative" json:"narrative"`
+	ImageKey  string `bson:"image_key,omitempty" json:"image_key,omitempty"`
 }
 
 type Schema struct {
@@ -48,6 +100,9 @@ type Schema struct {
 	InsertSQL string `bson:"insert_sql" json:"insert_sql"`
 }
 
+// CommandResponse.Condition aceita uma expressão (ex: "puzzle = 3 AND
+// focus = 'quadro'") ou um dos nomes antigos (always, puzzle_state, ...),
+// que usam Value como argumento.
 type CommandResponse struct {
 	Command     string `bson:"command" json:"command"`
 	Condition   string `bson:"condition" json:"condition"`
@@ -56,6 +111,14 @@ type CommandResponse struct {
 	ImageKey    string `bson:"image_key,omitempty" json:"image_key,omitempty"`
 	UnlocksNext bool   `bson:"unlocks_next,omitempty" json:"unlocks_next,omitempty"`
 	NextPuzzle  int    `bson:"next_puzzle,omitempty" json:"next_puzzle,omitempty"`
+
+	// Efeitos na história aplicados quando a resposta é usada.
+	SetFlags   []string       `bson:"set_flags,omitempty" json:"set_flags,omitempty"`
+	ClearFlags []string       `bson:"clear_flags,omitempty" json:"clear_flags,omitempty"`
+	Increment  map[string]int `bson:"increment,omitempty" json:"increment,omitempty"`
+	AddItems   []string       `bson:"add_items,omitempty" json:"add_items,omitempty"`
+
+	condition *conditions.Expr
 }
 
 type Validation struct {
@@ -69,23 +132,192 @@ type Validation struct {
 	FailureImageKey  string `json:"failure_image_key,omitempty" bson:"failure_image_key,omitempty"`
 	UnlocksNext      bool   `json:"unlocks_next" bson:"unlocks_next"`
 	NextPuzzle       int    `json:"next_puzzle" bson:"next_puzzle"`
+
+	// Operator compara o valor de CheckSQL com ExpectValue (=, !=, >, >=, <,
+	// <=, regex) ou com ExpectValues (between, in); null dispensa valor.
+	// Validações com o mesmo Group precisam passar juntas.
+	Operator     string   `json:"operator,omitempty" bson:"operator,omitempty"`
+	ExpectValues []string `json:"expect_values,omitempty" bson:"expect_values,omitempty"`
+	Group        string   `json:"group,omitempty" bson:"group,omitempty"`
+	Label        string   `json:"label,omitempty" bson:"label,omitempty"`
+
+	// Usados pelo tipo "result_check": o resultado do SELECT do jogador é
+	// comparado ao de ReferenceSQL executado no mesmo banco.
+	ReferenceSQL      string  `json:"reference_sql,omitempty" bson:"reference_sql,omitempty"`
+	OrderSensitive    bool    `json:"order_sensitive,omitempty" bson:"order_sensitive,omitempty"`
+	IgnoreColumnNames bool    `json:"ignore_column_names,omitempty" bson:"ignore_column_names,omitempty"`
+	NumericTolerance  float64 `json:"numeric_tolerance,omitempty" bson:"numeric_tolerance,omitempty"`
+	// FeedbackLevel controla quanto o feedback de um result_check revela:
+	// none, rows, columns ou full.
+	FeedbackLevel string `json:"feedback_level,omitempty" bson:"feedback_level,omitempty"`
 }
 
+// FocusRequirement vale para o puzzle indicado (ou para todos, com Puzzle 0
+// e Condition preenchida). Com Condition, o comando é liberado quando a
+// expressão é verdadeira em vez de comparar o foco com RequiredFocus.
 type FocusRequirement struct {
 	Puzzle        int      `bson:"puzzle" json:"puzzle"`
 	CommandTypes  []string `bson:"command_types" json:"command_types"`
 	RequiredFocus string   `bson:"required_focus" json:"required_focus"`
 	ErrorMessage  string   `bson:"error_message" json:"error_message"`
+	Condition     string   `bson:"condition,omitempty" json:"condition,omitempty"`
+
+	condition *conditions.Expr
 }
 
+// SQLFunction documenta uma função para o jogador e, quando Builtin é
+// informado, registra no sandbox a implementação correspondente da
+// biblioteca do motor, configurada por Params.
 type SQLFunction struct {
+	Name        string            `bson:"name" json:"name"`
+	Description string            `bson:"description" json:"description"`
+	Example     string            `bson:"example" json:"example"`
+	Builtin     string            `bson:"builtin,omitempty" json:"builtin,omitempty"`
+	Params      map[string]string `bson:"params,omitempty" json:"params,omitempty"`
+}
+
+// Accusation configura o comando ACUSAR. A acusação é boa com o culpado
+// certo e ao menos MinEvidence evidências corretas (todas, se zero);
+// parcial com o culpado certo e menos evidências; errada nos demais casos.
+// Cada acusação que não for boa gasta uma das MaxAttempts tentativas (uma,
+// se zero); a última encerra o caso com o final do resultado.
+type Accusation struct {
+	Culprit     string   `bson:"culprit" json:"culprit"`
+	Evidence    []string `bson:"evidence" json:"evidence"`
+	MinEvidence int      `bson:"min_evidence,omitempty" json:"min_evidence,omitempty"`
+	Suspects    []string `bson:"suspects,omitempty" json:"suspects,omitempty"`
+	MaxAttempts int      `bson:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+	// Com EvidenceFromInventory, só vale citar evidências que o jogador
+	// carrega no inventário.
+	EvidenceFromInventory bool   `bson:"evidence_from_inventory,omitempty" json:"evidence_from_inventory,omitempty"`
+	Condition             string `bson:"condition,omitempty" json:"condition,omitempty"`
+	LockedMessage         string `bson:"locked_message,omitempty" json:"locked_message,omitempty"`
+	RetryNarrative        string `bson:"retry_narrative,omitempty" json:"retry_narrative,omitempty"`
+
+	GoodEnding    string `bson:"good_ending" json:"good_ending"`
+	PartialEnding string `bson:"partial_ending" json:"partial_ending"`
+	WrongEnding   string `bson:"wrong_ending" json:"wrong_ending"`
+
+	condition *conditions.Expr
+}
+
+// Available diz se o jogador já pode acusar.
+func (a *Accusation) Available(state conditions.State) bool {
+	if a.condition == nil {
+		return true
+	}
+	return a.condition.Eval(state)
+}
+
+// CaseItem descreve um item que o jogador pode carregar; o ID é o usado em
+// AddItems e nas condições (item.<id>).
+type CaseItem struct {
+	ID          string `bson:"id" json:"id"`
 	Name        string `bson:"name" json:"name"`
-	Description string `bson:"description" json:"description"`
-	Example     string `bson:"example" json:"example"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
 }
 
+// HelpText com Condition só aparece quando a expressão é verdadeira, além
+// do filtro por Puzzle.
 type HelpText struct {
-	Puzzle  int    `bson:"puzzle" json:"puzzle"`
-	Topic   string `bson:"topic" json:"topic"`
-	Content string `bson:"content" json:"content"`
+	Puzzle    int    `bson:"puzzle" json:"puzzle"`
+	Topic     string `bson:"topic" json:"topic"`
+	Content   string `bson:"content" json:"content"`
+	Condition string `bson:"condition,omitempty" json:"condition,omitempty"`
+
+	condition *conditions.Expr
+}
+
+// CompileConditions analisa e verifica todas as condições do caso uma única
+// vez, ao carregá-lo. Condições inválidas nunca são satisfeitas e voltam na
+// lista de erros; as do formato antigo (condition + value) que não convertem
+// só geram um aviso no log, como o motor antigo, que as ignorava.
+func (c *Case) CompileConditions() []error {
+	if c.conditionsCompiled {
+		return nil
+	}
+	c.conditionsCompiled = true
+
+	errs := make([]error, 0)
+	compile := func(where, source string, fallback *conditions.Expr) *conditions.Expr {
+		if source == "" {
+			return fallback
+		}
+		expr, err := conditions.Compile(source)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			return conditions.Never
+		}
+		return expr
+	}
+
+	for i := range c.CommandResponses {
+		resp := &c.CommandResponses[i]
+		where := fmt.Sprintf("command_responses[%d] (%s)", i, resp.Command)
+		if conditions.IsLegacy(resp.Condition) {
+			// condições antigas que não convertem nunca casam, como antes
+			expr, err := conditions.Legacy(resp.Condition, resp.Value)
+			if err != nil {
+				log.Printf("Aviso: caso %s, %s: %v", c.ID, where, err)
+				expr = conditions.Never
+			}
+			resp.condition = expr
+			continue
+		}
+		if conditions.IsLegacyName(resp.Condition) {
+			// uma palavra solta que não compila é um nome antigo desconhecido
+			expr, err := conditions.Compile(resp.Condition)
+			if err != nil {
+				log.Printf("Aviso: caso %s, %s: condição desconhecida %q", c.ID, where, resp.Condition)
+				expr = conditions.Never
+			}
+			resp.condition = expr
+			continue
+		}
+		resp.condition = compile(where, resp.Condition, conditions.Never)
+	}
+
+	for i := range c.FocusRequirements {
+		req := &c.FocusRequirements[i]
+		if req.Condition == "" {
+			continue
+		}
+		// requisito inválido volta a usar só RequiredFocus
+		expr, err := conditions.Compile(req.Condition)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("focus_requirements[%d]: %w", i, err))
+			continue
+		}
+		req.condition = expr
+	}
+
+	if c.Accusation != nil && c.Accusation.Condition != "" {
+		c.Accusation.condition = compile("accusation", c.Accusation.Condition, conditions.Never)
+	}
+
+	for i := range c.HelpTexts {
+		ht := &c.HelpTexts[i]
+		ht.condition = compile(fmt.Sprintf("help_texts[%d] (%s)", i, ht.Topic), ht.Condition, conditions.Always)
+	}
+
+	return errs
+}
+
+// Matches avalia a condição compilada da resposta.
+func (r CommandResponse) Matches(state conditions.State) bool {
+	return r.condition.Eval(state)
+}
+
+// Available diz se o texto de ajuda pode ser mostrado agora.
+func (h HelpText) Available(state conditions.State) bool {
+	if h.condition == nil {
+		return true
+	}
+	return h.condition.Eval(state)
+}
+
+// CompiledCondition devolve a condição do requisito, ou nil quando ele usa
+// só RequiredFocus.
+func (f FocusRequirement) CompiledCondition() *conditions.Expr {
+	return f.condition
 }
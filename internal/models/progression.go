@@ -1,6 +1,9 @@
 package models
 
 import (
+	"hash/fnv"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,28 +15,226 @@ type Progression struct {
 	CaseID        string             `bson:"case_id" json:"case_id"`
 	CurrentPuzzle int                `bson:"current_puzzle" json:"current_puzzle"`
 	CurrentFocus  string             `bson:"current_focus" json:"current_focus"`
-	SQLHistory    []SQLHistoryItem   `bson:"sql_history" json:"sql_history"`
+	// FocusStack é o caminho até o foco atual (ex: mesa, gaveta); o último
+	// elemento é sempre CurrentFocus.
+	FocusStack []string         `bson:"focus_stack,omitempty" json:"focus_stack,omitempty"`
+	SQLHistory []SQLHistoryItem `bson:"sql_history" json:"sql_history"`
+
+	// PendingSQL guarda os comandos de uma transação aberta pelo jogador,
+	// reaplicados depois do histórico até o COMMIT ou ROLLBACK.
+	PendingSQL    []SQLHistoryItem `bson:"pending_sql,omitempty" json:"pending_sql,omitempty"`
+	InTransaction bool             `bson:"in_transaction,omitempty" json:"in_transaction,omitempty"`
 
 	PuzzleCheckpoints map[string]int `bson:"puzzle_checkpoints,omitempty" json:"puzzle_checkpoints,omitempty"`
 
+	// StoryState é gravado no início de cada puzzle em StoryCheckpoints,
+	// pela mesma chave de PuzzleCheckpoints, e restaurado pelo RESET PUZZLE.
+	StoryState       `bson:",inline"`
+	StoryCheckpoints map[string]StoryState `bson:"story_checkpoints,omitempty" json:"-"`
+
+	// Diverged indica que a reexecução do histórico não reproduziu o banco
+	// que o jogador viu; fica marcado até um reparo.
+	Diverged   bool        `bson:"diverged,omitempty" json:"diverged,omitempty"`
+	Divergence *Divergence `bson:"divergence,omitempty" json:"divergence,omitempty"`
+
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 	Completed bool      `bson:"completed" json:"completed"`
+	// CompletedAt marca quando o caso foi encerrado nesta tentativa; a
+	// pontuação é calculada nesse momento.
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	// Ending é o ID do final alcançado, quando o caso declara finais, e
+	// Outcome o resultado da acusação que encerrou o caso.
+	Ending      string              `bson:"ending,omitempty" json:"ending,omitempty"`
+	Outcome     string              `bson:"outcome,omitempty" json:"outcome,omitempty"`
+	Accusations []AccusationAttempt `bson:"accusations,omitempty" json:"accusations,omitempty"`
+
+	// HintsUsed registra cada dica revelada pelo DICA; não é desfeito pelo
+	// RESET PUZZLE.
+	HintsUsed []HintUse `bson:"hints_used,omitempty" json:"hints_used,omitempty"`
+
+	// PuzzleStats usa as mesmas chaves de PuzzleCheckpoints.
+	PuzzleStats map[string]PuzzleStats `bson:"puzzle_stats,omitempty" json:"puzzle_stats,omitempty"`
+}
+
+// HintUse guarda o desconto efetivo da dica, já resolvido o padrão do
+// scoring.
+type HintUse struct {
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+	Puzzle    int       `bson:"puzzle" json:"puzzle"`
+	Tier      int       `bson:"tier" json:"tier"`
+	Penalty   int       `bson:"penalty,omitempty" json:"penalty,omitempty"`
+}
+
+// HintsFor conta as dicas já reveladas no puzzle.
+func (p *Progression) HintsFor(puzzle int) int {
+	count := 0
+	for _, h := range p.HintsUsed {
+		if h.Puzzle == puzzle {
+			count++
+		}
+	}
+	return count
+}
+
+const (
+	OutcomeGood    = "good"
+	OutcomePartial = "partial"
+	OutcomeWrong   = "wrong"
+)
+
+type AccusationAttempt struct {
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+	Suspect   string    `bson:"suspect" json:"suspect"`
+	Evidence  []string  `bson:"evidence,omitempty" json:"evidence,omitempty"`
+	Outcome   string    `bson:"outcome" json:"outcome"`
+}
+
+// StoryState é o estado da história consultado pelas condições do caso:
+// puzzles resolvidos, flags, contadores, itens carregados e objetos já
+// examinados com OLHAR.
+type StoryState struct {
+	Solved    []int           `bson:"solved_puzzles,omitempty" json:"solved_puzzles,omitempty"`
+	Flags     map[string]bool `bson:"flags,omitempty" json:"flags,omitempty"`
+	Counters  map[string]int  `bson:"counters,omitempty" json:"counters,omitempty"`
+	Inventory []string        `bson:"inventory,omitempty" json:"inventory,omitempty"`
+	Visited   []string        `bson:"visited,omitempty" json:"visited,omitempty"`
+}
+
+// Clone copia o estado sem compartilhar mapas e slices.
+func (s StoryState) Clone() StoryState {
+	clone := StoryState{
+		Solved:    append([]int(nil), s.Solved...),
+		Inventory: append([]string(nil), s.Inventory...),
+		Visited:   append([]string(nil), s.Visited...),
+	}
+	if s.Flags != nil {
+		clone.Flags = make(map[string]bool, len(s.Flags))
+		for k, v := range s.Flags {
+			clone.Flags[k] = v
+		}
+	}
+	if s.Counters != nil {
+		clone.Counters = make(map[string]int, len(s.Counters))
+		for k, v := range s.Counters {
+			clone.Counters[k] = v
+		}
+	}
+	return clone
+}
+
+// FocusPath devolve a pilha de foco, da raiz ao foco atual. Progressões
+// antigas só têm CurrentFocus.
+func (p *Progression) FocusPath() []string {
+	if len(p.FocusStack) > 0 {
+		return p.FocusStack
+	}
+	if p.CurrentFocus == "" || p.CurrentFocus == "none" {
+		return nil
+	}
+	return []string{p.CurrentFocus}
+}
+
+// InFocus diz se o objeto é o foco atual ou um dos que o contêm.
+func (p *Progression) InFocus(object string) bool {
+	for _, f := range p.FocusPath() {
+		if strings.EqualFold(f, object) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFocusPath troca a pilha inteira e mantém CurrentFocus no topo.
+func (p *Progression) SetFocusPath(path []string) {
+	if len(path) == 0 {
+		p.ClearFocus()
+		return
+	}
+	p.FocusStack = path
+	p.CurrentFocus = path[len(path)-1]
+}
+
+func (p *Progression) ClearFocus() {
+	p.FocusStack = nil
+	p.CurrentFocus = "none"
+}
+
+// SchemaPuzzle é o maior puzzle já aberto na progressão, que define quais
+// tabelas do caso entram no banco: com puzzles em paralelo, voltar a um de
+// número menor não pode esconder as tabelas de outro.
+func (p *Progression) SchemaPuzzle() int {
+	puzzle := p.CurrentPuzzle
+	for key := range p.PuzzleCheckpoints {
+		if n, err := strconv.Atoi(key); err == nil && n > puzzle {
+			puzzle = n
+		}
+	}
+	return puzzle
+}
+
+// EffectiveHistory devolve o histórico confirmado seguido dos comandos da
+// transação pendente, que é o que o sandbox precisa reaplicar.
+func (p *Progression) EffectiveHistory() []SQLHistoryItem {
+	if len(p.PendingSQL) == 0 {
+		return p.SQLHistory
+	}
+	history := make([]SQLHistoryItem, 0, len(p.SQLHistory)+len(p.PendingSQL))
+	history = append(history, p.SQLHistory...)
+	return append(history, p.PendingSQL...)
+}
+
+// RandomSeed é a semente de random() no sandbox: fixa por jogador e caso,
+// para que o histórico reexecutado gere sempre os mesmos valores.
+func (p *Progression) RandomSeed() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(p.UserID.Hex() + ":" + p.CaseID))
+	return int64(h.Sum64())
 }
 
 type SQLHistoryItem struct {
 	Timestamp   time.Time `bson:"timestamp" json:"timestamp"`
 	Query       string    `bson:"query" json:"query"`
+	Normalized  string    `bson:"normalized_query,omitempty" json:"-"`
 	PuzzleState int       `bson:"puzzle_state" json:"puzzle_state"`
 	FocusState  string    `bson:"focus_state" json:"focus_state"`
+	// Checksum é o hash do estado do sandbox logo após o comando, conferido
+	// nos pontos de verificação da reexecução. Só o último item de cada
+	// comando o recebe.
+	Checksum string `bson:"checksum,omitempty" json:"-"`
+}
+
+const (
+	RepairLastGood         = "last_good"
+	RepairPuzzleCheckpoint = "puzzle_checkpoint"
+)
+
+// Divergence aponta o primeiro item do histórico (índice no histórico
+// efetivo) cuja reexecução falhou ou não reproduziu o estado gravado.
+type Divergence struct {
+	Index         int       `bson:"index" json:"index"`
+	Query         string    `bson:"query" json:"query"`
+	Reason        string    `bson:"reason" json:"reason"`
+	DetectedAt    time.Time `bson:"detected_at" json:"detected_at"`
+	RepairOptions []string  `bson:"-" json:"repair_options,omitempty"`
 }
 
 type GameState struct {
 	CaseID        string   `json:"case_id"`
 	CurrentPuzzle int      `json:"current_puzzle"`
 	CurrentFocus  string   `json:"current_focus"`
+	FocusPath     []string `json:"focus_path,omitempty"`
 	Tables        []string `json:"tables"`
 	Commands      []string `json:"commands"`
 	Narrative     string   `json:"narrative,omitempty"`
 	ImageKey      string   `json:"image_key,omitempty"`
+	InTransaction bool     `json:"in_transaction,omitempty"`
+	PendingCount  int      `json:"pending_count,omitempty"`
+	Diverged      bool     `json:"diverged,omitempty"`
+	Inventory     []string `json:"inventory,omitempty"`
+	Solved        []int    `json:"solved_puzzles,omitempty"`
+	Available     []int    `json:"available_puzzles,omitempty"`
+	Completed     bool     `json:"completed,omitempty"`
+	Ending        string   `json:"ending,omitempty"`
+	Outcome       string   `json:"outcome,omitempty"`
 }
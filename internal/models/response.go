@@ -1,26 +1,190 @@
 package models
 
 type GameResponse struct {
-	Success         bool        `json:"success"`
-	Narrative       string      `json:"narrative,omitempty"`
-	Data            interface{} `json:"data,omitempty"`
-	Error           string      `json:"error,omitempty"`
-	State           GameState   `json:"state,omitempty"`
-	IsReset         bool        `json:"is_reset,omitempty"`
-	IsDebug         bool        `json:"is_debug,omitempty"`
-	ImageKey        string      `json:"image_key"`
-	SuccessImageKey string      `json:"success_image_key,omitempty"`
-	FailureImageKey string      `json:"failure_image_key,omitempty"`
+	Success         bool              `json:"success"`
+	Narrative       string            `json:"narrative,omitempty"`
+	Data            interface{}       `json:"data,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	ErrorCode       string            `json:"error_code,omitempty"`
+	ErrorClass      string            `json:"error_class,omitempty"`
+	ErrorDetail     *SQLErrorDetail   `json:"error_detail,omitempty"`
+	State           GameState         `json:"state,omitempty"`
+	IsReset         bool              `json:"is_reset,omitempty"`
+	IsDebug         bool              `json:"is_debug,omitempty"`
+	ImageKey        string            `json:"image_key"`
+	SuccessImageKey string            `json:"success_image_key,omitempty"`
+	FailureImageKey string            `json:"failure_image_key,omitempty"`
+	Statements      []StatementResult `json:"statements,omitempty"`
+	Changes         *DMLChanges       `json:"changes,omitempty"`
+	Undo            *UndoSummary      `json:"undo,omitempty"`
+	Repair          *RepairSummary    `json:"repair,omitempty"`
+	Divergence      *Divergence       `json:"divergence,omitempty"`
+	Ending          *Ending           `json:"ending,omitempty"`
+	Accusation      *AccusationResult `json:"accusation,omitempty"`
+	Hint            *HintResult       `json:"hint,omitempty"`
+	Score           *Score            `json:"score,omitempty"`
+	Unmet           []string          `json:"unmet_conditions,omitempty"`
+	Feedback        *ResultFeedback   `json:"feedback,omitempty"`
 }
 
+// UndoSummary lista os comandos desfeitos, do mais recente para o mais
+// antigo, e quantos ainda podem ser desfeitos no puzzle atual.
+type UndoSummary struct {
+	Count      int      `json:"count"`
+	Statements []string `json:"statements"`
+	Remaining  int      `json:"remaining"`
+}
+
+// RepairSummary descreve o reparo de uma progressão divergente: quantos
+// comandos do histórico foram mantidos e quais foram descartados.
+type RepairSummary struct {
+	Mode       string   `json:"mode"`
+	Kept       int      `json:"kept"`
+	Removed    int      `json:"removed"`
+	Statements []string `json:"statements"`
+}
+
+// AccusationResult resume uma acusação. O resultado só é revelado quando a
+// acusação encerra o caso.
+type AccusationResult struct {
+	Final        bool   `json:"final"`
+	Outcome      string `json:"outcome,omitempty"`
+	AttemptsLeft int    `json:"attempts_left"`
+}
+
+// HintResult diz qual nível de dica foi mostrado e quantos o puzzle tem.
+// New é falso quando não havia dica nova e a última foi repetida.
+type HintResult struct {
+	Tier    int  `json:"tier"`
+	Total   int  `json:"total"`
+	Penalty int  `json:"penalty,omitempty"`
+	New     bool `json:"new"`
+}
+
+// StatementResult descreve cada comando de um script com mais de um
+// comando, na ordem em que foram executados.
+type StatementResult struct {
+	Index        int             `json:"index"`
+	SQL          string          `json:"sql"`
+	Kind         string          `json:"kind"`
+	Success      bool            `json:"success"`
+	Data         interface{}     `json:"data,omitempty"`
+	RowsAffected int64           `json:"rows_affected,omitempty"`
+	Changes      *DMLChanges     `json:"changes,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	ErrorCode    string          `json:"error_code,omitempty"`
+	ErrorClass   string          `json:"error_class,omitempty"`
+	ErrorDetail  *SQLErrorDetail `json:"error_detail,omitempty"`
+}
+
+// DMLChanges mostra o efeito de um INSERT, UPDATE ou DELETE comparando as
+// linhas tocadas antes e depois do comando, pelo rowid.
+type DMLChanges struct {
+	RowsAffected int64          `json:"rows_affected"`
+	Tables       []TableChanges `json:"tables,omitempty"`
+	Truncated    bool           `json:"truncated,omitempty"`
+}
+
+type TableChanges struct {
+	Table    string          `json:"table"`
+	Columns  []string        `json:"columns"`
+	Inserted [][]interface{} `json:"inserted,omitempty"`
+	Deleted  [][]interface{} `json:"deleted,omitempty"`
+	Updated  []RowChange     `json:"updated,omitempty"`
+}
+
+type RowChange struct {
+	Before         []interface{} `json:"before"`
+	After          []interface{} `json:"after"`
+	ChangedColumns []string      `json:"changed_columns"`
+}
+
+// ResultFeedback aponta onde o SELECT do jogador difere do resultado
+// esperado, no nível de detalhe escolhido pela validação.
+type ResultFeedback struct {
+	Messages       []string `json:"messages"`
+	ExtraRows      int      `json:"extra_rows,omitempty"`
+	MissingRows    int      `json:"missing_rows,omitempty"`
+	MissingColumns []string `json:"missing_columns,omitempty"`
+	ExtraColumns   []string `json:"extra_columns,omitempty"`
+	OrderMismatch  bool     `json:"order_mismatch,omitempty"`
+}
+
+type SQLErrorDetail struct {
+	Class       string   `json:"class"`
+	Raw         string   `json:"raw,omitempty"`
+	Explanation string   `json:"explanation"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+const (
+	ErrorClassSyntax          = "syntax"
+	ErrorClassUnknownTable    = "unknown_table"
+	ErrorClassUnknownColumn   = "unknown_column"
+	ErrorClassAmbiguousColumn = "ambiguous_column"
+	ErrorClassConstraint      = "constraint_violation"
+	ErrorClassFocusRequired   = "focus_required"
+	ErrorClassPolicyDenied    = "policy_denied"
+	ErrorClassTimeout         = "timeout"
+	ErrorClassExecution       = "execution"
+)
+
+// QueryResult devolve as linhas como arrays na ordem das colunas. NULL é
+// representado por null e BLOBs por um literal hexadecimal (X'...').
 type QueryResult struct {
-	Columns []string                 `json:"columns"`
-	Rows    []map[string]interface{} `json:"rows"`
+	Columns     []string        `json:"columns"`
+	ColumnTypes []ColumnType    `json:"column_types"`
+	Rows        [][]interface{} `json:"rows"`
+	RowCount    int             `json:"row_count"`
+	Truncated   bool            `json:"truncated"`
+}
+
+type ColumnType struct {
+	Name         string `json:"name"`
+	DeclaredType string `json:"declared_type"`
+	RuntimeType  string `json:"runtime_type"`
 }
 
+// LegacyQueryResult é o formato antigo, com cada linha como mapa
+// coluna -> valor, mantido para clientes que pedem result_format "map".
+type LegacyQueryResult struct {
+	Columns   []string                 `json:"columns"`
+	Rows      []map[string]interface{} `json:"rows"`
+	Truncated bool                     `json:"truncated"`
+}
+
+func (r QueryResult) Legacy() LegacyQueryResult {
+	rows := make([]map[string]interface{}, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		m := make(map[string]interface{}, len(r.Columns))
+		for i, col := range r.Columns {
+			if i < len(row) {
+				m[col] = row[i]
+			}
+		}
+		rows = append(rows, m)
+	}
+	return LegacyQueryResult{
+		Columns:   r.Columns,
+		Rows:      rows,
+		Truncated: r.Truncated,
+	}
+}
+
+const (
+	ResultFormatTable = "table"
+	ResultFormatMap   = "map"
+)
+
 type ExecuteRequest struct {
+	CaseID       string `json:"case_id" validate:"required"`
+	SQL          string `json:"sql" validate:"required"`
+	ResultFormat string `json:"result_format,omitempty"`
+}
+
+type RepairRequest struct {
 	CaseID string `json:"case_id" validate:"required"`
-	SQL    string `json:"sql" validate:"required"`
+	Mode   string `json:"mode" validate:"required"`
 }
 
 type InitializeRequest struct {
@@ -42,12 +206,25 @@ func (e APIError) Error() string {
 }
 
 const (
-	ErrInvalidSQL       = "INVALID_SQL"
-	ErrFocusRequired    = "FOCUS_REQUIRED"
-	ErrCaseNotFound     = "CASE_NOT_FOUND"
-	ErrPlayerNotFound   = "PLAYER_NOT_FOUND"
-	ErrValidationFailed = "VALIDATION_FAILED"
-	ErrInternalError    = "INTERNAL_ERROR"
-	ErrUnauthorized     = "UNAUTHORIZED"
-	ErrInvalidToken     = "INVALID_TOKEN"
+	ErrInvalidSQL        = "INVALID_SQL"
+	ErrFocusRequired     = "FOCUS_REQUIRED"
+	ErrCaseNotFound      = "CASE_NOT_FOUND"
+	ErrPlayerNotFound    = "PLAYER_NOT_FOUND"
+	ErrValidationFailed  = "VALIDATION_FAILED"
+	ErrInternalError     = "INTERNAL_ERROR"
+	ErrUnauthorized      = "UNAUTHORIZED"
+	ErrInvalidToken      = "INVALID_TOKEN"
+	ErrPolicyDenied      = "POLICY_DENIED"
+	ErrStatementDenied   = "STATEMENT_NOT_ALLOWED"
+	ErrTableDenied       = "TABLE_NOT_ALLOWED"
+	ErrQueryTimeout      = "QUERY_TIMEOUT"
+	ErrScriptTooLong     = "SCRIPT_TOO_LONG"
+	ErrTransactionState  = "TRANSACTION_STATE"
+	ErrUndoUnavailable   = "UNDO_UNAVAILABLE"
+	ErrHistoryConflict   = "HISTORY_CONFLICT"
+	ErrRepairUnavailable = "REPAIR_UNAVAILABLE"
+	ErrPuzzleUnavailable = "PUZZLE_UNAVAILABLE"
+	ErrAccusationInvalid = "ACCUSATION_INVALID"
+	ErrHintUnavailable   = "HINT_UNAVAILABLE"
+	ErrResetUnavailable  = "RESET_UNAVAILABLE"
 )
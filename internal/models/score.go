@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScoringConfig define os pesos da pontuação de um caso. Cada puzzle
+// resolvido vale PuzzlePoints, menos as tentativas com erro, as dicas e os
+// minutos além de ParMinutes; o final alcançado soma EndingBonus, procurado
+// pelo ID do final e depois pelo resultado da acusação (good, partial, wrong).
+type ScoringConfig struct {
+	PuzzlePoints         int            `bson:"puzzle_points" json:"puzzle_points"`
+	FailedAttemptPenalty int            `bson:"failed_attempt_penalty" json:"failed_attempt_penalty"`
+	HintPenalty          int            `bson:"hint_penalty" json:"hint_penalty"`
+	ParMinutes           int            `bson:"par_minutes" json:"par_minutes"`
+	MinutePenalty        int            `bson:"minute_penalty" json:"minute_penalty"`
+	EndingBonus          map[string]int `bson:"ending_bonus,omitempty" json:"ending_bonus,omitempty"`
+}
+
+// DefaultScoring é usada pelos casos sem scoring configurado.
+func DefaultScoring() ScoringConfig {
+	return ScoringConfig{
+		PuzzlePoints:         100,
+		FailedAttemptPenalty: 5,
+		HintPenalty:          10,
+		ParMinutes:           10,
+		MinutePenalty:        1,
+		EndingBonus: map[string]int{
+			OutcomeGood:    200,
+			OutcomePartial: 100,
+		},
+	}
+}
+
+// PuzzleStats acompanha um puzzle da progressão para a pontuação.
+type PuzzleStats struct {
+	StartedAt      time.Time  `bson:"started_at" json:"started_at"`
+	SolvedAt       *time.Time `bson:"solved_at,omitempty" json:"solved_at,omitempty"`
+	FailedAttempts int        `bson:"failed_attempts,omitempty" json:"failed_attempts,omitempty"`
+}
+
+type PuzzleScore struct {
+	Puzzle         int   `bson:"puzzle" json:"puzzle"`
+	Points         int   `bson:"points" json:"points"`
+	FailedAttempts int   `bson:"failed_attempts" json:"failed_attempts"`
+	HintsUsed      int   `bson:"hints_used" json:"hints_used"`
+	HintPenalty    int   `bson:"hint_penalty" json:"hint_penalty"`
+	ElapsedSeconds int64 `bson:"elapsed_seconds" json:"elapsed_seconds"`
+	TimePenalty    int   `bson:"time_penalty" json:"time_penalty"`
+}
+
+// Score é a pontuação de um jogador em um caso, gravada quando o caso é
+// encerrado. Só a melhor de cada jogador fica guardada.
+type Score struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"-"`
+	CaseID         string             `bson:"case_id" json:"case_id"`
+	DisplayName    string             `bson:"display_name" json:"display_name"`
+	Guest          bool               `bson:"guest" json:"guest"`
+	Public         bool               `bson:"public" json:"public"`
+	Total          int                `bson:"total" json:"total"`
+	Puzzles        []PuzzleScore      `bson:"puzzles" json:"puzzles"`
+	EndingBonus    int                `bson:"ending_bonus" json:"ending_bonus"`
+	Ending         string             `bson:"ending,omitempty" json:"ending,omitempty"`
+	Outcome        string             `bson:"outcome,omitempty" json:"outcome,omitempty"`
+	ElapsedSeconds int64              `bson:"elapsed_seconds" json:"elapsed_seconds"`
+	CompletedAt    time.Time          `bson:"completed_at" json:"completed_at"`
+}
+
+// LeaderboardPrefs guarda a escolha do jogador de aparecer ou não nos
+// rankings. Sem preferência, convidados ficam de fora e usuários
+// registrados aparecem.
+type LeaderboardPrefs struct {
+	UserID      primitive.ObjectID `bson:"_id"`
+	OptIn       bool               `bson:"opt_in"`
+	DisplayName string             `bson:"display_name,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at"`
+}
+
+type LeaderboardOptInRequest struct {
+	OptIn       bool   `json:"opt_in"`
+	DisplayName string `json:"display_name"`
+}
+
+type LeaderboardEntry struct {
+	Rank           int       `bson:"-" json:"rank"`
+	DisplayName    string    `bson:"display_name" json:"display_name"`
+	Guest          bool      `bson:"guest" json:"guest"`
+	Total          int       `bson:"total" json:"total"`
+	CasesCompleted int       `bson:"cases_completed,omitempty" json:"cases_completed,omitempty"`
+	Ending         string    `bson:"ending,omitempty" json:"ending,omitempty"`
+	Outcome        string    `bson:"outcome,omitempty" json:"outcome,omitempty"`
+	ElapsedSeconds int64     `bson:"elapsed_seconds,omitempty" json:"elapsed_seconds,omitempty"`
+	CompletedAt    time.Time `bson:"completed_at" json:"completed_at"`
+}
+
+type LeaderboardPage struct {
+	CaseID   string             `json:"case_id,omitempty"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+	Total    int64              `json:"total"`
+	Entries  []LeaderboardEntry `json:"entries"`
+}
@@ -19,6 +19,11 @@ type TelemetryEvent struct {
 
 	Query         string          `bson:"query,omitempty"`
 	QueryFeatures map[string]bool `bson:"query_features,omitempty"`
+	StatementKind string          `bson:"statement_kind,omitempty"`
+	// StatementKinds lista o tipo de cada comando quando a entrada é um
+	// script; nesse caso StatementKind é "script".
+	StatementKinds []string `bson:"statement_kinds,omitempty"`
+	Tables         []string `bson:"tables,omitempty"`
 
 	Command       string `bson:"command,omitempty"`
 	CommandTarget string `bson:"command_target,omitempty"`
@@ -26,6 +31,16 @@ type TelemetryEvent struct {
 	Result TelemetryResult `bson:"result"`
 
 	FocusState string `bson:"focus_state"`
+
+	Hint *TelemetryHint `bson:"hint,omitempty"`
+}
+
+// TelemetryHint marca os eventos em que o jogador pediu uma dica.
+type TelemetryHint struct {
+	Tier    int  `bson:"tier"`
+	Total   int  `bson:"total"`
+	Penalty int  `bson:"penalty"`
+	New     bool `bson:"new"`
 }
 
 type TelemetryResult struct {
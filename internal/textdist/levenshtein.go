@@ -0,0 +1,27 @@
+// Package textdist mede a distância entre textos, usada nas sugestões de
+// erro do motor e na função DISTANCIA do sandbox.
+package textdist
+
+// Levenshtein é o número mínimo de inserções, remoções e trocas de
+// caractere para transformar a em b. O custo é len(a)·len(b): quem recebe
+// texto do jogador deve limitar o tamanho antes de chamar.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}